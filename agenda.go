@@ -0,0 +1,166 @@
+package wasgeit
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AgendaSort is the order of the events returned by Store.FindAgenda.
+type AgendaSort string
+
+const (
+	SortByDate              AgendaSort = "date"
+	SortByDateDescending    AgendaSort = "-date"
+	SortByCreated           AgendaSort = "created"
+	SortByCreatedDescending AgendaSort = "-created"
+)
+
+func (sort AgendaSort) orDefault() AgendaSort {
+	if sort == "" {
+		return SortByDate
+	}
+	return sort
+}
+
+// MaxAgendaLimit is the maximum number of events returned at once.
+const MaxAgendaLimit = 500
+
+// AgendaQuery selects the events of the agenda, its zero value selects all upcoming events ordered by date.
+type AgendaQuery struct {
+	// From defaults to the start of the current day, To is exclusive and there is no upper bound if it is zero
+	From time.Time
+	To   time.Time
+	// Venues are short names, all venues are included if empty
+	Venues []string
+	// Text is searched for in the titles, descriptions and venue names, all of its words have to match
+	Text string
+	// Limit restricts the number of events, a cursor to the following events is returned if there are more
+	Limit  int
+	Cursor string
+	Sort   AgendaSort
+}
+
+// AgendaPage holds the events found by Store.FindAgenda, NextCursor is empty on the last page.
+type AgendaPage struct {
+	Events     []Event
+	NextCursor string
+}
+
+// Validate checks the parameters of the query.
+func (q AgendaQuery) Validate() error {
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return errors.New("from has to be before to")
+	}
+
+	if q.Limit < 0 || q.Limit > MaxAgendaLimit {
+		return fmt.Errorf("limit has to be between 1 and %d", MaxAgendaLimit)
+	}
+
+	if _, err := q.sortKey(); err != nil {
+		return err
+	}
+
+	if q.Cursor != "" {
+		if _, err := q.decodeCursor(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sortKey returns the column the query is sorted by and whether the order is descending.
+func (q AgendaQuery) sortKey() (agendaSortKey, error) {
+	switch q.Sort {
+	case "", SortByDate:
+		return agendaSortKey{column: "events.date"}, nil
+	case SortByDateDescending:
+		return agendaSortKey{column: "events.date", descending: true}, nil
+	case SortByCreated:
+		return agendaSortKey{column: "events.created"}, nil
+	case SortByCreatedDescending:
+		return agendaSortKey{column: "events.created", descending: true}, nil
+	default:
+		return agendaSortKey{}, fmt.Errorf("unknown sort order %q", q.Sort)
+	}
+}
+
+type agendaSortKey struct {
+	column     string
+	descending bool
+}
+
+// value returns the value of the sort column of an event, formatted like the datetime function of SQLite does.
+func (key agendaSortKey) value(ev Event) string {
+	t := ev.DateTime
+	if key.column == "events.created" {
+		t = ev.Created
+	}
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// agendaCursor points behind the last event of a page, it is valid for a single sort order.
+type agendaCursor struct {
+	sort  AgendaSort
+	value string
+	id    int64
+}
+
+// time returns the value of the sort column, which is in UTC.
+func (cursor agendaCursor) time() time.Time {
+	t, _ := time.Parse("2006-01-02 15:04:05", cursor.value)
+	return t
+}
+
+func (q AgendaQuery) encodeCursor(key agendaSortKey, last Event) string {
+	raw := fmt.Sprintf("%s|%s|%d", q.Sort.orDefault(), key.value(last), last.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func (q AgendaQuery) decodeCursor() (agendaCursor, error) {
+	invalid := errors.New("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+
+	if err != nil {
+		return agendaCursor{}, invalid
+	}
+
+	parts := strings.Split(string(raw), "|")
+
+	if len(parts) != 3 {
+		return agendaCursor{}, invalid
+	}
+
+	cursor := agendaCursor{sort: AgendaSort(parts[0]), value: parts[1]}
+
+	if cursor.sort != q.Sort.orDefault() {
+		return agendaCursor{}, errors.New("the cursor belongs to another sort order")
+	}
+
+	if _, err := time.Parse("2006-01-02 15:04:05", cursor.value); err != nil {
+		return agendaCursor{}, invalid
+	}
+
+	if cursor.id, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return agendaCursor{}, invalid
+	}
+
+	return cursor, nil
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns, with \ as escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// likePattern turns a word into a LIKE pattern matching texts containing it, with \ as escape character.
+func likePattern(word string) string {
+	return "%" + likeEscaper.Replace(word) + "%"
+}
+
+// likePrefix turns a prefix into a LIKE pattern matching texts starting with it, with \ as escape character.
+func likePrefix(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
@@ -0,0 +1,23 @@
+package wasgeit
+
+import (
+	"embed"
+	"fmt"
+)
+
+// assets holds the schema, the venue seed data and the migrations of each dialect along with the built-in crawler
+// definitions, so the binaries do not depend on the working directory.
+//
+//go:embed sql/*.sql sql/migrations/*.sql sql/postgres/*.sql sql/postgres/migrations crawlers/*.yaml
+var assets embed.FS
+
+// readAsset returns the content of an embedded file, e.g. "sql/create-schema.sql".
+func readAsset(name string) (string, error) {
+	content, err := assets.ReadFile(name)
+
+	if err != nil {
+		return "", fmt.Errorf("reading %s failed: %v", name, err)
+	}
+
+	return string(content), nil
+}
@@ -0,0 +1,376 @@
+package wasgeit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LastVenueCrawlTimeKey is the key of the time a venue was crawled last, see ApplyCrawl.
+func LastVenueCrawlTimeKey(crawlerName string) string {
+	return LastCrawlTimeKey + ":" + crawlerName
+}
+
+// CrawlResult is everything a crawl of a venue leaves to be stored.
+type CrawlResult struct {
+	Changes ChangeSet
+	// Errors are logged to the errors table
+	Errors []error
+	// Details are the detail pages fetched during the crawl
+	Details []CachedDetails
+	// Crawled is recorded as the last crawl of the venue
+	Crawled time.Time
+}
+
+// CrawlSummary counts the rows written by ApplyCrawl.
+type CrawlSummary struct {
+	New        int
+	Updated    int
+	Missing    int
+	Removed    int
+	Reappeared int
+	// Logged is the number of entries added to the updates of the events
+	Logged  int
+	Errors  int
+	Details int
+	// Conflicting is the number of new events and updates left out, as they clash with other events
+	Conflicting int
+}
+
+// ApplyCrawl stores the result of crawling a venue in a single transaction. New events and updates clashing with
+// other events are left out and logged as errors, so a single event cannot hold back its venue crawl after crawl. If
+// anything else fails nothing but the errors of the crawl is stored.
+func (store *Store) ApplyCrawl(cr Crawler, result CrawlResult) (CrawlSummary, error) {
+	summary, err := store.inBatch(func(b *batch) (CrawlSummary, error) {
+		return b.apply(store, cr, result)
+	})
+
+	if err != nil {
+		store.logErrors(cr, result.Errors)
+		return CrawlSummary{}, fmt.Errorf("failed to store crawl of %q: %v", cr.Name(), err)
+	}
+
+	return summary, nil
+}
+
+// logErrors stores the errors of a crawl whose changes could not be stored, failures are only logged.
+func (store *Store) logErrors(cr Crawler, errs []error) {
+	_, err := store.inBatch(func(b *batch) (CrawlSummary, error) {
+		var summary CrawlSummary
+		return summary, b.logErrors(cr, errs, &summary)
+	})
+
+	if err != nil {
+		log.Errorf("Storing the errors of %q failed: %v", cr.Name(), err)
+	}
+}
+
+// inBatch runs write in a transaction, which is committed unless write fails.
+func (store *Store) inBatch(write func(b *batch) (CrawlSummary, error)) (CrawlSummary, error) {
+	tx, err := store.db.Begin()
+
+	if err != nil {
+		return CrawlSummary{}, err
+	}
+
+	b := &batch{tx: tx, statements: make(map[string]*sql.Stmt)}
+	summary, err := write(b)
+	b.close()
+
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return CrawlSummary{}, fmt.Errorf("%v, rollback failed too: %v", err, rollbackErr)
+		}
+		return CrawlSummary{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return CrawlSummary{}, err
+	}
+
+	return summary, nil
+}
+
+// parkEventQuery moves an event out of the way of the others, its public ID is a title no other event of the venue has.
+const parkEventQuery = `UPDATE events SET title = public_id WHERE id = ?`
+
+// batch executes the queries of a transaction, each query is prepared once.
+type batch struct {
+	tx         *transaction
+	statements map[string]*sql.Stmt
+}
+
+func (b *batch) exec(query string, args ...interface{}) error {
+	stmt, prepared := b.statements[query]
+
+	if !prepared {
+		var err error
+		stmt, err = b.tx.Prepare(query)
+
+		if err != nil {
+			return err
+		}
+
+		b.statements[query] = stmt
+	}
+
+	_, err := stmt.Exec(args...)
+	return err
+}
+
+func (b *batch) close() {
+	for _, stmt := range b.statements {
+		stmt.Close()
+	}
+}
+
+func (b *batch) logUpdate(eventID int64, fieldName string, oldValue interface{}, newValue interface{}) error {
+	err := b.exec(insertUpdateQuery, eventID, fieldName, formatFieldValue(oldValue), formatFieldValue(newValue))
+
+	if err != nil {
+		return fmt.Errorf("logging update of %q in event %d failed: %v", fieldName, eventID, err)
+	}
+
+	return nil
+}
+
+// inSavepoint undoes the statements of write if it fails, while the rest of the transaction goes on.
+func (b *batch) inSavepoint(name string, write func() error) error {
+	if _, err := b.tx.Exec("SAVEPOINT " + name); err != nil {
+		return err
+	}
+
+	if err := write(); err != nil {
+		if _, rollbackErr := b.tx.Exec("ROLLBACK TO SAVEPOINT " + name); rollbackErr != nil {
+			return fmt.Errorf("%v, rollback failed too: %v", err, rollbackErr)
+		}
+		if _, releaseErr := b.tx.Exec("RELEASE SAVEPOINT " + name); releaseErr != nil {
+			return fmt.Errorf("%v, releasing the savepoint failed too: %v", err, releaseErr)
+		}
+		return err
+	}
+
+	_, err := b.tx.Exec("RELEASE SAVEPOINT " + name)
+	return err
+}
+
+func (b *batch) logErrors(cr Crawler, errs []error, summary *CrawlSummary) error {
+	for _, errToLog := range errs {
+		if err := b.exec(insertErrorQuery, cr.Name(), errToLog.Error()); err != nil {
+			return fmt.Errorf("storing error %q failed: %v", errToLog, err)
+		}
+		summary.Errors++
+	}
+
+	return nil
+}
+
+// update sets the changed fields of an event and logs them. The title of a parked event is set even if it did not
+// change.
+func (b *batch) update(update Update, parked bool, summary *CrawlSummary) error {
+	id := update.ExistingEv.ID
+	fields := update.ChangedFields
+	logged := 0
+
+	if parked {
+		fields = append([]string{FieldTitle}, fields...)
+	}
+
+	for i, field := range fields {
+		query, err := updateEventQuery(field)
+
+		if err != nil {
+			return err
+		}
+
+		oldValue, newValue := update.Values(field)
+
+		if err := b.exec(query, append(columnValues(field, newValue), id)...); err != nil {
+			return fmt.Errorf("updating %q in event %d failed: %w", field, id, err)
+		}
+
+		if parked && i == 0 {
+			continue
+		}
+
+		if err := b.logUpdate(id, field, oldValue, newValue); err != nil {
+			return err
+		}
+		logged++
+	}
+
+	summary.Updated++
+	summary.Logged += logged
+	return nil
+}
+
+// applyUpdates applies each update on its own and returns the ones clashing with other events.
+func (b *batch) applyUpdates(updates []Update, summary *CrawlSummary) ([]Update, error) {
+	var clashing []Update
+
+	for _, update := range updates {
+		applied := *summary
+		err := b.inSavepoint("event_update", func() error {
+			return b.update(update, false, &applied)
+		})
+
+		if b.tx.dialect.isConflict(err) {
+			clashing = append(clashing, update)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		*summary = applied
+	}
+
+	return clashing, nil
+}
+
+// applySwaps applies updates which clash with each other, e.g. two events swapping their titles. The events are
+// parked first, so none of them is in the way of another. Unless all of them can be applied, none is.
+func (b *batch) applySwaps(updates []Update, summary *CrawlSummary) (bool, error) {
+	applied := *summary
+	err := b.inSavepoint("event_swap", func() error {
+		for _, update := range updates {
+			if err := b.exec(parkEventQuery, update.ExistingEv.ID); err != nil {
+				return err
+			}
+		}
+
+		for _, update := range updates {
+			if err := b.update(update, true, &applied); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if b.tx.dialect.isConflict(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	*summary = applied
+	return true, nil
+}
+
+func (b *batch) apply(store *Store, cr Crawler, result CrawlResult) (CrawlSummary, error) {
+	var summary CrawlSummary
+	var conflicts []error
+	cs := result.Changes
+
+	// the updates come first, as they may make way for new events. An update may be in the way of another one until
+	// that is applied, so the clashing ones are tried again as long as some of them succeed.
+	pending := cs.Updates
+	for len(pending) > 0 {
+		clashing, err := b.applyUpdates(pending, &summary)
+
+		if err != nil {
+			return summary, err
+		}
+
+		if len(clashing) == len(pending) {
+			break
+		}
+		pending = clashing
+	}
+
+	if len(pending) > 0 {
+		swapped, err := b.applySwaps(pending, &summary)
+
+		if err != nil {
+			return summary, err
+		}
+
+		if !swapped {
+			for _, update := range pending {
+				conflicts = append(conflicts, fmt.Errorf("update of event %d to %q on %s clashes with another event",
+					update.ExistingEv.ID, update.UpdatedEv.Title, update.UpdatedEv.DateTime))
+			}
+		}
+	}
+
+	for _, ev := range cs.New {
+		err := b.inSavepoint("new_event", func() error {
+			return b.exec(insertEventQuery, insertEventArgs(ev)...)
+		})
+
+		if b.tx.dialect.isConflict(err) {
+			conflicts = append(conflicts, fmt.Errorf("new event %q on %s clashes with another event", ev.Title, ev.DateTime))
+			continue
+		} else if err != nil {
+			return summary, fmt.Errorf("saving event %v failed: %v", ev, err)
+		}
+		summary.New++
+	}
+
+	for _, ev := range cs.Missing {
+		if err := b.exec(setMissingCrawlsQuery, ev.MissingCrawls, ev.ID); err != nil {
+			return summary, fmt.Errorf("setting missing crawls of event %d failed: %v", ev.ID, err)
+		}
+		summary.Missing++
+	}
+
+	for _, ev := range cs.Removed {
+		if err := b.exec(markEventRemovedQuery, ev.MissingCrawls, store.Now(), ev.RemovalReason, ev.ID); err != nil {
+			return summary, fmt.Errorf("marking event %d as removed failed: %v", ev.ID, err)
+		}
+
+		if err := b.logUpdate(ev.ID, FieldRemoved, "", ev.RemovalReason); err != nil {
+			return summary, err
+		}
+		summary.Removed++
+		summary.Logged++
+	}
+
+	for _, ev := range cs.Reappeared {
+		if err := b.exec(restoreEventQuery, ev.ID); err != nil {
+			return summary, fmt.Errorf("restoring event %d failed: %v", ev.ID, err)
+		}
+
+		if !ev.Removed.IsZero() {
+			if err := b.logUpdate(ev.ID, FieldRemoved, ev.RemovalReason, ""); err != nil {
+				return summary, err
+			}
+			summary.Logged++
+		}
+		summary.Reappeared++
+	}
+
+	detailsQuery := store.db.dialect.upsert("event_details", "url", "url", "details", "etag", "last_modified", "fetched")
+
+	for _, cached := range result.Details {
+		details, err := json.Marshal(cached.Details)
+
+		if err != nil {
+			return summary, err
+		}
+
+		err = b.exec(detailsQuery, cached.URL, string(details), cached.Validators.ETag, cached.Validators.LastModified, cached.Fetched)
+
+		if err != nil {
+			return summary, fmt.Errorf("caching details of %q failed: %v", cached.URL, err)
+		}
+		summary.Details++
+	}
+
+	summary.Conflicting = len(conflicts)
+
+	if err := b.logErrors(cr, append(result.Errors, conflicts...), &summary); err != nil {
+		return summary, err
+	}
+
+	crawled := result.Crawled.Format(time.RFC3339)
+
+	if err := b.exec(store.db.dialect.upsert("keyvalue", "key", "key", "value"), LastVenueCrawlTimeKey(cr.Name()), crawled); err != nil {
+		return summary, fmt.Errorf("setting the last crawl time failed: %v", err)
+	}
+
+	return summary, nil
+}
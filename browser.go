@@ -10,7 +10,6 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"time"
 )
 
 type Browser struct {
@@ -117,28 +116,90 @@ func getWsUrl(chromiumRemoteUrl *url.URL) (string, error) {
 	return "", fmt.Errorf("no default page found on %q", chromiumRemoteUrl.String())
 }
 
-func (b *Browser) GetHtml(url string) (string, error) {
+// GetHtml opens url in a new tab, waits until the page is ready according to wait and returns the rendered HTML.
+// The tab is closed when ctxt is done.
+func (b *Browser) GetHtml(ctxt context.Context, url string, wait WaitCondition) (string, error) {
 	log.Debug("Opening new tab for ", url)
 
-	ctxt, cancel := chromedp.NewContext(b.ctxt) // create new tab
-	defer cancel()                              // close tab
+	// chromedp needs its own context hierarchy, therefore the deadline and the cancellation of ctxt are carried over
+	// before the tab is created, so a browser which does not respond cannot hold up the crawl
+	runCtxt, cancelRun := context.WithCancel(b.ctxt)
+	defer cancelRun()
+
+	if deadline, ok := ctxt.Deadline(); ok {
+		var cancelDeadline context.CancelFunc
+		runCtxt, cancelDeadline = context.WithDeadline(runCtxt, deadline)
+		defer cancelDeadline()
+	}
+
+	go func() {
+		select {
+		case <-ctxt.Done():
+			cancelRun()
+		case <-runCtxt.Done():
+		}
+	}()
+
+	// chromedp closes the tab once its context is cancelled, even if runCtxt is done by then
+	tabCtxt, cancel := chromedp.NewContext(runCtxt) // create new tab
+	defer cancel()                                  // close tab
+
+	if err := chromedp.Run(tabCtxt); err != nil {
+		return "", contextErrorOr(ctxt, err)
+	}
 
 	log.Trace("Created")
 
 	log.Trace("Running tasks..")
 
+	if err := chromedp.Run(tabCtxt, chromedp.Navigate(url)); err != nil {
+		return "", contextErrorOr(ctxt, err)
+	}
+
+	waitCtxt, cancelWait := context.WithTimeout(tabCtxt, wait.timeout())
+	err := chromedp.Run(waitCtxt, wait.actions()...)
+	cancelWait()
+
+	if ctxt.Err() != nil {
+		return "", ctxt.Err()
+	} else if err != nil {
+		// the page may still be usable, e.g. an agenda without events never shows the awaited selector
+		log.Warnf("Waiting for %q to be ready failed, continuing anyway: %s", url, err)
+	}
+
 	var body string
-	if err := chromedp.Run(ctxt,
-		chromedp.Navigate(url),
-		chromedp.Sleep(time.Second),
-		chromedp.OuterHTML("html", &body),
-	); err != nil {
-		return body, err
+	if err := chromedp.Run(tabCtxt, chromedp.OuterHTML("html", &body)); err != nil {
+		return body, contextErrorOr(ctxt, err)
 	}
 
 	return body, nil
 }
 
+func contextErrorOr(ctxt context.Context, err error) error {
+	if ctxt.Err() != nil {
+		return ctxt.Err()
+	}
+	return err
+}
+
+func (b *Browser) Fetch(ctxt context.Context, url string) (string, error) {
+	return b.GetHtml(ctxt, url, WaitCondition{})
+}
+
+// WithWait returns a Fetcher which waits for the given condition before reading the page.
+func (b *Browser) WithWait(wait WaitCondition) Fetcher {
+	return &waitingBrowser{browser: b, wait: wait}
+}
+
+type waitingBrowser struct {
+	browser *Browser
+	wait    WaitCondition
+}
+
+func (wb *waitingBrowser) Fetch(ctxt context.Context, url string) (string, error) {
+	return wb.browser.GetHtml(ctxt, url, wb.wait)
+}
+
 func (b *Browser) Close() {
 	b.cancel()
 	log.Debug("Disconnected")
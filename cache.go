@@ -0,0 +1,285 @@
+package wasgeit
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cacheControl allows clients and proxies to reuse responses for a few minutes, crawls happen far less often.
+const cacheControl = "public, max-age=300"
+
+// maxCachedResponses bounds the memory held by the cache, the least recently used responses are dropped first.
+const maxCachedResponses = 256
+
+// cachedResponse is a successful response along with the validators used to answer conditional requests.
+type cachedResponse struct {
+	header http.Header
+	body   []byte
+	// etag is strong as it is derived from the bytes of the body, each representation gets its own
+	etag         string
+	lastModified time.Time
+}
+
+// responseCache holds the responses of the server until the data they were built from changes. Its version is made of
+// the last crawl times, of the whole crawl and of each venue, along with the current date, as the agenda depends on
+// both.
+type responseCache struct {
+	mutex     sync.Mutex
+	version   string
+	responses map[string]*list.Element
+	// recent orders the cache entries from the most to the least recently used
+	recent *list.List
+}
+
+type cacheEntry struct {
+	key      string
+	response cachedResponse
+}
+
+func (cache *responseCache) get(version string, key string) (cachedResponse, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.version != version {
+		return cachedResponse{}, false
+	}
+
+	element, found := cache.responses[key]
+
+	if !found {
+		return cachedResponse{}, false
+	}
+
+	cache.recent.MoveToFront(element)
+	return element.Value.(cacheEntry).response, true
+}
+
+func (cache *responseCache) put(version string, key string, response cachedResponse) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.version != version || cache.responses == nil {
+		cache.version = version
+		cache.responses = make(map[string]*list.Element)
+		cache.recent = list.New()
+	}
+
+	if element, found := cache.responses[key]; found {
+		element.Value = cacheEntry{key: key, response: response}
+		cache.recent.MoveToFront(element)
+		return
+	}
+
+	cache.responses[key] = cache.recent.PushFront(cacheEntry{key: key, response: response})
+
+	if cache.recent.Len() > maxCachedResponses {
+		oldest := cache.recent.Remove(cache.recent.Back()).(cacheEntry)
+		delete(cache.responses, oldest.key)
+	}
+}
+
+func (cache *responseCache) len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return len(cache.responses)
+}
+
+// bufferedResponse records the response of a handler.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+}
+
+func (br *bufferedResponse) Header() http.Header {
+	return br.header
+}
+
+func (br *bufferedResponse) Write(b []byte) (int, error) {
+	return br.body.Write(b)
+}
+
+func (br *bufferedResponse) WriteHeader(status int) {
+	br.status = status
+}
+
+func (br *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for name, values := range br.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(br.status)
+	w.Write(br.body.Bytes())
+}
+
+// cacheVersion changes whenever a venue was crawled or a day passed. The latest crawl is returned as the time of the
+// last modification.
+func (server *Server) cacheVersion() (string, time.Time, error) {
+	crawlTimes, err := server.store.ReadCrawlTimes()
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	keys := make([]string, 0, len(crawlTimes))
+
+	for key := range crawlTimes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var version strings.Builder
+	var crawled time.Time
+
+	for _, key := range keys {
+		version.WriteString(key + "=" + crawlTimes[key] + "|")
+
+		if t, err := time.Parse(time.RFC3339, crawlTimes[key]); err == nil && t.After(crawled) {
+			crawled = t
+		}
+	}
+
+	version.WriteString(server.store.Now().In(location).Format("2006-01-02"))
+	return version.String(), crawled, nil
+}
+
+// cached serves the responses of the handler from the cache and answers conditional requests. Unless the handler sets
+// Last-Modified, the time of the last crawl is used.
+func (server *Server) cached(handler http.HandlerFunc) http.HandlerFunc {
+	return server.withValidators(handler, true)
+}
+
+// validated answers conditional requests like cached, but runs the handler for every request. It suits responses
+// which depend on more than the path and the query, or whose variety would only flush the cache.
+func (server *Server) validated(handler http.HandlerFunc) http.HandlerFunc {
+	return server.withValidators(handler, false)
+}
+
+// cacheKey identifies a response by the path and the query, the order of the query parameters does not matter.
+func cacheKey(r *http.Request) string {
+	return r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+func (server *Server) withValidators(handler http.HandlerFunc, keep bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			handler(w, r)
+			return
+		}
+
+		version, crawled, err := server.cacheVersion()
+
+		if err != nil {
+			// without knowing whether the data changed, the response is neither cached nor taken from the cache
+			log.Error(err)
+			handler(w, r)
+			return
+		}
+
+		key := cacheKey(r)
+		response, found := cachedResponse{}, false
+
+		if keep {
+			response, found = server.cache.get(version, key)
+		}
+
+		if !found {
+			recorded := newBufferedResponse()
+			handler(recorded, r)
+
+			if recorded.status != http.StatusOK {
+				recorded.writeTo(w)
+				return
+			}
+
+			response = newCachedResponse(recorded, crawled)
+
+			if keep {
+				server.cache.put(version, key, response)
+			}
+		}
+
+		response.serve(w, r)
+	}
+}
+
+func newCachedResponse(recorded *bufferedResponse, crawled time.Time) cachedResponse {
+	hash := sha1.Sum(recorded.body.Bytes())
+	response := cachedResponse{
+		header:       recorded.header,
+		body:         recorded.body.Bytes(),
+		etag:         `"` + hex.EncodeToString(hash[:10]) + `"`,
+		lastModified: crawled,
+	}
+
+	if lastModified, err := http.ParseTime(recorded.header.Get("Last-Modified")); err == nil {
+		response.lastModified = lastModified
+	}
+
+	return response
+}
+
+func (response cachedResponse) serve(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+
+	for name, values := range response.header {
+		h[name] = values
+	}
+
+	h.Set("ETag", response.etag)
+	h.Set("Cache-Control", cacheControl)
+
+	if !response.lastModified.IsZero() {
+		h.Set("Last-Modified", response.lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if response.notModified(r) {
+		h.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if r.Method != http.MethodHead {
+		w.Write(response.body)
+	}
+}
+
+// notModified evaluates If-None-Match and, only if it is missing, If-Modified-Since (RFC 7232, section 6).
+func (response cachedResponse) notModified(r *http.Request) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, response.etag)
+	}
+
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" && !response.lastModified.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		return err == nil && !response.lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// etagMatches compares the ETags of an If-None-Match header weakly, as proxies may turn the ETag into a weak one when
+// they compress the response.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package wasgeit
+
+import "time"
+
+// Clock tells the current time. It is passed to crawlers and the store so their results can be reproduced.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock reads the time from the operating system.
+var SystemClock Clock = systemClock{}
+
+// FixedClock always returns the same point in time.
+type FixedClock time.Time
+
+func (c FixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func orSystemClock(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
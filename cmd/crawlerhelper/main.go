@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/bjorm/wasgeit"
 )
@@ -21,19 +23,12 @@ func main() {
 	}
 
 	st := wasgeit.Store{}
-	err := st.Connect()
+	err := st.Connect(config.DSN)
 
 	panicOnError(err)
 
-	browser, err := wasgeit.StartBrowser(config.ChromiumUrl)
-
-	if err != nil {
-		panic(err)
-	}
-
-	defer browser.Close()
-
-	wasgeit.RegisterAllHTMLCrawlers(&st)
+	err = wasgeit.RegisterAllHTMLCrawlers(&st, config.CrawlerDir)
+	panicOnError(err)
 
 	cr := wasgeit.GetCrawler(*crName)
 
@@ -41,18 +36,23 @@ func main() {
 		panic(fmt.Sprintf("No crawler %q found", *crName))
 	}
 
-	var f *os.File
-	filename := fmt.Sprintf("%s%s.%s", tmpDataDir, cr.Name(), inferExtension(cr))
+	if _, err := os.Stat(pageFilename(cr, 1)); err != nil {
+		fetchers := wasgeit.Fetchers{wasgeit.FetchWithHTTP: wasgeit.NewHTTPFetcher()}
 
-	if _, err := os.Stat(filename); err != nil {
-		downloadSite(filename, cr, browser)
-	}
+		if cr.FetchMode() == wasgeit.FetchWithBrowser {
+			browser, err := wasgeit.StartBrowser(config.ChromiumUrl)
+			panicOnError(err)
+			defer browser.Close()
+			fetchers[wasgeit.FetchWithBrowser] = &browser
+		}
 
-	bytes, err := ioutil.ReadFile(filename)
-	panicOnError(err)
-	defer f.Close()
+		fetcher, err := fetchers.For(cr)
+		panicOnError(err)
 
-	err = cr.Read(string(bytes))
+		downloadSite(cr, fetcher, config.CrawlTimeout)
+	}
+
+	err = cr.Read(readPages(cr)...)
 	panicOnError(err)
 
 	events, errors := cr.GetEvents()
@@ -65,6 +65,7 @@ func main() {
 		fmt.Printf("title: %q\n", ev.Title)
 		fmt.Printf("parsed time: %q\n", ev.DateTime)
 		fmt.Printf("link: %q\n", ev.URL)
+		fmt.Printf("status: %q\n", ev.Status)
 		fmt.Println()
 	}
 
@@ -82,16 +83,45 @@ func inferExtension(cr wasgeit.Crawler) string {
 	}
 }
 
-func downloadSite(filename string, cr wasgeit.Crawler, browser wasgeit.Browser) {
-	body, err := browser.GetHtml(cr.URL())
-	panicOnError(err)
+// pageFilename returns the name of the file storing the given page, the first page is stored as <crawler>.html,
+// the following ones as <crawler>-<page>.html.
+func pageFilename(cr wasgeit.Crawler, page int) string {
+	if page == 1 {
+		return fmt.Sprintf("%s%s.%s", tmpDataDir, cr.Name(), inferExtension(cr))
+	}
+	return fmt.Sprintf("%s%s-%d.%s", tmpDataDir, cr.Name(), page, inferExtension(cr))
+}
 
-	newLocalFile, err := os.Create(filename)
-	panicOnError(err)
-	defer newLocalFile.Close()
+func readPages(cr wasgeit.Crawler) []string {
+	var bodies []string
+
+	for page := 1; ; page++ {
+		bytes, err := ioutil.ReadFile(pageFilename(cr, page))
+
+		if os.IsNotExist(err) && page > 1 {
+			return bodies
+		}
+		panicOnError(err)
+
+		bodies = append(bodies, string(bytes))
+	}
+}
+
+func downloadSite(cr wasgeit.Crawler, fetcher wasgeit.Fetcher, timeout time.Duration) {
+	ctxt, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	_, err = newLocalFile.WriteString(body)
+	bodies, err := wasgeit.FetchPages(ctxt, cr, fetcher)
 	panicOnError(err)
+
+	for i, body := range bodies {
+		newLocalFile, err := os.Create(pageFilename(cr, i+1))
+		panicOnError(err)
+
+		_, err = newLocalFile.WriteString(body)
+		panicOnError(err)
+		panicOnError(newLocalFile.Close())
+	}
 }
 
 func panicOnError(err error) {
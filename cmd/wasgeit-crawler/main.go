@@ -13,7 +13,7 @@ func main() {
 	wasgeit.ConfigureLogging(config.LogLevel)
 
 	store := &wasgeit.Store{}
-	dbErr := store.Connect()
+	dbErr := store.Connect(config.DSN)
 
 	if dbErr != nil {
 		panic(dbErr)
@@ -36,89 +36,54 @@ func main() {
 		}
 	}
 
-	wasgeit.RegisterAllHTMLCrawlers(store)
+	if dbErr = store.Migrate(); dbErr != nil {
+		panic(dbErr)
+	}
 
-	browser, err := wasgeit.StartBrowser(config.ChromiumUrl)
+	if config.RebuildSearch {
+		log.Info("Rebuilding search index..")
+		indexed, err := store.RebuildSearchIndex()
+		if err != nil {
+			panic(err)
+		}
+		log.Infof("Indexed %d events", indexed)
+	}
+
+	err := wasgeit.RegisterAllHTMLCrawlers(store, config.CrawlerDir)
 
 	if err != nil {
 		panic(err)
 	}
 
-	defer browser.Close()
-
-	for _, cr := range wasgeit.GetCrawlers() {
-		log.Info(cr.Name())
+	crawlers := wasgeit.GetCrawlers()
+	fetchers := wasgeit.Fetchers{wasgeit.FetchWithHTTP: wasgeit.NewHTTPFetcher()}
 
-		body, err := browser.GetHtml(cr.URL())
-
-		log.Debug("Got site body from browser")
-
-		if err != nil {
-			log.Errorf("Fetching failed: %s", err)
-			continue
-		}
-
-		err = cr.Read(body)
+	if needsBrowser(crawlers) {
+		browser, err := wasgeit.StartBrowser(config.ChromiumUrl)
 
 		if err != nil {
-			log.Errorf("Reading failed: %s", err)
-			continue
+			panic(err)
 		}
 
-		newEvents, crawlErrors := cr.GetEvents()
-
-		if len(newEvents) == 0 {
-			log.Errorf("Crawler %q returned no events", cr.Name())
-			continue
-		}
-
-		// TODO use channel and goroutines for this
-
-		existingEvents := store.FindEvents(cr.Name())
-
-		if len(existingEvents) == 0 {
-			log.Warnf("No existing events found")
-		}
+		defer browser.Close()
+		fetchers[wasgeit.FetchWithBrowser] = &browser
+	}
 
-		cs := wasgeit.DedupeAndTrackChanges(existingEvents, newEvents, cr)
-		var storeErrors []error
-
-		for _, update := range cs.Updates {
-			for _, field := range update.ChangedFields {
-				var newValue, oldValue interface{}
-				switch field {
-				case "title":
-					newValue = update.UpdatedEv.Title
-					oldValue = update.ExistingEv.Title
-					break
-				case "date":
-					newValue = update.UpdatedEv.DateTime
-					oldValue = update.ExistingEv.DateTime
-				default:
-					panic("Update not implemented.")
-				}
-				store.UpdateEvent(update.ExistingEv.ID, field, newValue)
-				store.LogUpdate(update.ExistingEv.ID, field, oldValue, newValue)
-			}
-		}
+	crawl(store, fetchers, crawlers, config.ParallelTabs, config.CrawlTimeout, config.RemovalGrace)
 
-		for _, event := range cs.New {
-			storeErr := store.SaveEvent(event)
+	if err := store.UpdateValue(wasgeit.LastCrawlTimeKey, store.Now().Format(time.RFC3339)); err != nil {
+		log.Errorf("Recording the time of the crawl failed: %s", err)
+	}
+}
 
-			if storeErr != nil {
-				storeErrors = append(storeErrors, storeErr)
-			}
+func needsBrowser(crawlers []wasgeit.Crawler) bool {
+	for _, cr := range crawlers {
+		if cr.FetchMode() == wasgeit.FetchWithBrowser {
+			return true
 		}
-
-		for _, err := range storeErrors {
-			store.LogError(cr, err)
+		if detailCr, ok := cr.(wasgeit.DetailCrawler); ok && detailCr.HasDetails() && detailCr.DetailFetchMode() == wasgeit.FetchWithBrowser {
+			return true
 		}
-
-		log.Infof("Crawl errors: %d", len(crawlErrors))
-		log.Infof("Store errors: %d", len(storeErrors))
-		log.Infof("Updates: %d", len(cs.Updates))
-		log.Infof("New events stored: %d", len(cs.New)-len(storeErrors))
 	}
-
-	store.UpdateValue(wasgeit.LastCrawlTimeKey, time.Now().Format(time.RFC3339))
+	return false
 }
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bjorm/wasgeit"
+	log "github.com/sirupsen/logrus"
+)
+
+type fetchResult struct {
+	cr     wasgeit.Crawler
+	bodies []string
+	err    error
+}
+
+type parseResult struct {
+	cr          wasgeit.Crawler
+	events      []wasgeit.Event
+	details     []wasgeit.CachedDetails
+	crawlErrors []error
+	// err is set if the site could not be crawled at all
+	err error
+}
+
+// crawl runs all crawlers through a pipeline of four stages: sites are fetched by parallelTabs workers, parsed as
+// they arrive, enriched with the detail pages of their events and handed to a single writer, as SQLite does not cope
+// well with concurrent writes. Fetching and enriching share the parallelTabs browser tabs.
+func crawl(store wasgeit.Storage, fetchers wasgeit.Fetchers, crawlers []wasgeit.Crawler, parallelTabs int, timeout time.Duration, removalGrace int) {
+	if parallelTabs < 1 {
+		parallelTabs = 1
+	}
+	tabs := make(chan struct{}, parallelTabs)
+
+	fetched := fetch(fetchers, crawlers, tabs, timeout)
+	parsed := parse(fetched)
+	enriched := enrich(store, fetchers, parsed, tabs, timeout)
+
+	var failed []string
+	for result := range enriched {
+		if !persist(store, result, removalGrace) {
+			failed = append(failed, result.cr.Name())
+		}
+	}
+
+	if len(failed) > 0 {
+		log.Warnf("Crawling %d of %d venues failed: %s", len(failed), len(crawlers), strings.Join(failed, ", "))
+	}
+
+	linkDuplicates(store)
+}
+
+// linkDuplicates links events listed by several venues to a canonical event, so they are listed once.
+func linkDuplicates(store wasgeit.Storage) {
+	events, err := store.FindUpcomingEvents()
+
+	if err != nil {
+		log.Errorf("Looking for duplicates failed: %s", err)
+		return
+	}
+
+	clusters := wasgeit.FindDuplicates(events)
+
+	if err := store.LinkDuplicates(clusters); err != nil {
+		log.Errorf("Linking duplicates failed: %s", err)
+		return
+	}
+
+	log.Infof("Linked %d events listed by several venues", len(clusters))
+}
+
+func fetch(fetchers wasgeit.Fetchers, crawlers []wasgeit.Crawler, tabs chan struct{}, timeout time.Duration) <-chan fetchResult {
+	jobs := make(chan wasgeit.Crawler)
+	results := make(chan fetchResult)
+	parallelTabs := cap(tabs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallelTabs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cr := range jobs {
+				fetcher, err := fetchers.For(cr)
+
+				if err != nil {
+					results <- fetchResult{cr: cr, err: err}
+					continue
+				}
+
+				tabs <- struct{}{}
+				ctxt, cancel := context.WithTimeout(context.Background(), timeout)
+				bodies, err := wasgeit.FetchPages(ctxt, cr, fetcher)
+				cancel()
+				<-tabs
+
+				log.Debugf("Got %d pages of %q using %s", len(bodies), cr.Name(), cr.FetchMode())
+				results <- fetchResult{cr: cr, bodies: bodies, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, cr := range crawlers {
+			jobs <- cr
+		}
+		close(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+func parse(fetched <-chan fetchResult) <-chan parseResult {
+	results := make(chan parseResult)
+
+	go func() {
+		defer close(results)
+
+		for result := range fetched {
+			cr := result.cr
+
+			if result.err != nil {
+				results <- parseResult{cr: cr, err: fmt.Errorf("fetching failed: %w", result.err)}
+				continue
+			}
+
+			if err := cr.Read(result.bodies...); err != nil {
+				results <- parseResult{cr: cr, err: fmt.Errorf("reading failed: %w", err)}
+				continue
+			}
+
+			newEvents, crawlErrors := cr.GetEvents()
+
+			if len(newEvents) == 0 {
+				results <- parseResult{cr: cr, err: errors.New("no events found"), crawlErrors: crawlErrors}
+				continue
+			}
+
+			results <- parseResult{cr: cr, events: newEvents, crawlErrors: crawlErrors}
+		}
+	}()
+
+	return results
+}
+
+// enrich reads the detail pages of the events of crawlers supporting it, the others are passed on untouched. Detail
+// pages still in the cache are not fetched again.
+func enrich(store wasgeit.Storage, fetchers wasgeit.Fetchers, parsed <-chan parseResult, tabs chan struct{}, timeout time.Duration) <-chan parseResult {
+	results := make(chan parseResult)
+	parallelTabs := cap(tabs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < parallelTabs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range parsed {
+				cr, ok := result.cr.(wasgeit.DetailCrawler)
+
+				if result.err != nil || !ok || !cr.HasDetails() {
+					results <- result
+					continue
+				}
+
+				fetcher, err := fetchers.ForDetails(cr)
+
+				if err != nil {
+					result.crawlErrors = append(result.crawlErrors, err)
+					results <- result
+					continue
+				}
+
+				detailFetcher := wasgeit.DetailFetcher{Fetcher: fetcher, Cache: store, Clock: store}
+
+				tabs <- struct{}{}
+				ctxt, cancel := context.WithTimeout(context.Background(), timeout)
+				events, details, errs := detailFetcher.Enrich(ctxt, cr, result.events)
+				cancel()
+				<-tabs
+
+				log.Debugf("Fetched %d detail pages of %q", len(details), cr.Name())
+				result.events = events
+				result.details = details
+				result.crawlErrors = append(result.crawlErrors, errs...)
+				results <- result
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// persist stores the changes found by a crawler in one transaction and reports whether the venue was crawled. Failures
+// are logged to the error table and do not stop the crawl of the other venues.
+func persist(store wasgeit.Storage, result parseResult, removalGrace int) bool {
+	cr := result.cr
+	logger := log.WithField("crawler", cr.Name())
+
+	if result.err != nil {
+		logger.Error(result.err)
+		logError(store, logger, cr, result.err)
+		return false
+	}
+
+	existingEvents, err := store.FindEvents(cr.Name())
+
+	if err != nil {
+		logger.Errorf("Reading the existing events failed: %s", err)
+		logError(store, logger, cr, err)
+		return false
+	}
+
+	if len(existingEvents) == 0 {
+		logger.Warnf("No existing events found")
+	}
+
+	opts := wasgeit.TrackingOptions{Now: store.Now(), RemovalGrace: removalGrace}
+	cs := wasgeit.DedupeAndTrackChanges(existingEvents, result.events, cr, opts)
+
+	summary, err := store.ApplyCrawl(cr, wasgeit.CrawlResult{
+		Changes: cs,
+		Errors:  result.crawlErrors,
+		Details: result.details,
+		Crawled: opts.Now,
+	})
+
+	if err != nil {
+		logger.Error(err)
+		logError(store, logger, cr, err)
+		return false
+	}
+
+	logger.Infof("Crawl errors: %d", summary.Errors)
+	logger.Infof("Updates: %d, logged changes: %d", summary.Updated, summary.Logged)
+	logger.Infof("New events stored: %d, left out as conflicting: %d", summary.New, summary.Conflicting)
+	logger.Infof("Missing: %d, removed: %d, reappeared: %d", summary.Missing, summary.Removed, summary.Reappeared)
+	logger.Infof("Detail pages cached: %d", summary.Details)
+	return true
+}
+
+// logError records an error of a crawler, if even that fails it is only logged.
+func logError(store wasgeit.Storage, logger *log.Entry, cr wasgeit.Crawler, errToLog error) {
+	if err := store.LogError(cr, errToLog); err != nil {
+		logger.Errorf("Logging %q failed: %s", errToLog, err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/bjorm/wasgeit"
+)
+
+const usage = `Usage: wasgeit-migrate [flags] <command>
+
+Commands:
+  status          lists the migrations and whether they were applied
+  up              applies all pending migrations
+  down [version]  reverts the latest migration, or all migrations above the given version
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	config := wasgeit.GetConfiguration()
+	wasgeit.ConfigureLogging(config.LogLevel)
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	store := &wasgeit.Store{}
+
+	if err := store.Connect(config.DSN); err != nil {
+		panic(err)
+	}
+	defer store.Close()
+
+	var err error
+
+	switch flag.Arg(0) {
+	case "status":
+		err = status(store)
+	case "up":
+		err = store.Migrate()
+	case "down":
+		err = down(store, flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func status(store wasgeit.Storage) error {
+	migrations, current, err := store.Migrations()
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version %d\n\n", current)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tREVERSIBLE")
+
+	for _, m := range migrations {
+		state := "pending"
+		if m.Version <= current {
+			state = "applied"
+			if !m.Applied.IsZero() {
+				state += " " + m.Applied.Local().Format("2006-01-02 15:04")
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%t\n", m.Version, m.Name, state, m.Reversible())
+	}
+
+	return w.Flush()
+}
+
+func down(store wasgeit.Storage, args []string) error {
+	current, err := store.SchemaVersion()
+
+	if err != nil {
+		return err
+	}
+
+	target := current - 1
+
+	if len(args) > 0 {
+		if target, err = strconv.Atoi(args[0]); err != nil || target >= current {
+			return fmt.Errorf("version has to be a number below the current version %d", current)
+		}
+	}
+
+	return store.MigrateTo(target)
+}
@@ -16,20 +16,21 @@ func main() {
 
 	log.Info("Built from ", BuildCommit, " at ", BuildTime)
 	store := &wasgeit.Store{}
-	dbErr := store.Connect()
+	dbErr := store.Connect(configuration.DSN)
 
 	if dbErr != nil {
 		panic(dbErr)
 	}
 	defer store.Close()
 
+	if dbErr = store.Migrate(); dbErr != nil {
+		panic(dbErr)
+	}
+
 	server := wasgeit.NewServer(store)
-	http.HandleFunc("/agenda", server.ServeAgenda)
-	http.HandleFunc("/news", server.ServeNews)
-	http.HandleFunc("/festivals", server.ServeFestivals)
 
 	log.Info("Serving..")
-	err := http.ListenAndServe(":8080", nil)
+	err := http.ListenAndServe(":8080", server.Handler())
 
 	if err != nil {
 		panic(err)
@@ -5,22 +5,44 @@ import (
 	log "github.com/sirupsen/logrus"
 	"runtime"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	DropDb      bool
-	SetupDb     bool
-	LogLevel    string
-	ChromiumUrl string
+	DropDb  bool
+	SetupDb bool
+	// RebuildSearch indexes all events for searching, e.g. after the search index was added to an existing DB
+	RebuildSearch bool
+	LogLevel      string
+	ChromiumUrl   string
+	// CrawlerDir is a directory of crawler definitions replacing the built-in ones
+	CrawlerDir string
+	// DSN is a postgres:// URL or the path of a SQLite database
+	DSN string
+	// ParallelTabs is the number of sites fetched concurrently by the crawler
+	ParallelTabs int
+	CrawlTimeout time.Duration
+	// RemovalGrace is the number of consecutive crawls an event may be missing from its venue's listing before it is
+	// removed from the agenda
+	RemovalGrace int
 }
 
 func GetConfiguration() Config {
 	config := Config{}
 	flag.BoolVar(&config.DropDb, "drop-db", false, "Whether to drop DB")
 	flag.BoolVar(&config.SetupDb, "setup-db", false, "Whether to create DB tables")
+	flag.BoolVar(&config.RebuildSearch, "rebuild-search", false, "Whether to (re)build the search index of all events")
 	flag.StringVar(&config.LogLevel, "log-level", "Info", "Set log level")
 	flag.StringVar(&config.ChromiumUrl, "chromium-host", "http://chromium:9222",
 		"Host of chromium instance to connect to. Do not specify a path.")
+	flag.StringVar(&config.CrawlerDir, "crawler-dir", "",
+		"Directory containing the crawler definitions, the built-in definitions are used if empty")
+	flag.StringVar(&config.DSN, "dsn", "db/wasgeit.db",
+		"Database to use, either a postgres:// URL or the path of a SQLite database")
+	flag.IntVar(&config.ParallelTabs, "parallel-tabs", 4, "Number of browser tabs used to fetch sites in parallel")
+	flag.DurationVar(&config.CrawlTimeout, "crawl-timeout", time.Minute, "Maximum time to fetch the site of a crawler")
+	flag.IntVar(&config.RemovalGrace, "removal-grace", 3,
+		"Number of consecutive crawls an event may be missing before it is removed, 0 keeps missing events")
 	flag.Parse()
 	return config
 }
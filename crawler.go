@@ -1,17 +1,51 @@
 package wasgeit
 
 import (
+	"context"
 	"fmt"
 )
 
 const LastCrawlTimeKey = "LAST_CRAWL_TIME"
 
 type Crawler interface {
+	// URL is the first page of the programme
 	URL() string
+	// NextURL returns the page following pageURL or an empty string if there is none
+	NextURL(pageURL string, body string, pageCount int) (string, error)
 	Name() string
-	Read(string) error
+	Read(bodies ...string) error
 	GetEvents() ([]Event, []error)
-	IsSame(ev1, ev2 Event) bool
+	// Identity returns a key identifying an event across crawls, e.g. its URL
+	Identity(ev Event) string
+	FetchMode() FetchMode
+	WaitCondition() WaitCondition
+}
+
+// maxPagesPerCrawl protects against pagination running in circles
+const maxPagesPerCrawl = 50
+
+// FetchPages fetches all pages of a crawler's programme by following its pagination.
+func FetchPages(ctxt context.Context, cr Crawler, fetcher Fetcher) ([]string, error) {
+	var bodies []string
+	visited := make(map[string]bool)
+
+	for url := cr.URL(); url != "" && !visited[url] && len(bodies) < maxPagesPerCrawl; {
+		visited[url] = true
+
+		body, err := fetcher.Fetch(ctxt, url)
+
+		if err != nil {
+			return nil, fmt.Errorf("fetching page %d (%s) failed: %v", len(bodies)+1, url, err)
+		}
+
+		bodies = append(bodies, body)
+
+		if url, err = cr.NextURL(url, body, len(bodies)); err != nil {
+			return nil, err
+		}
+	}
+
+	return bodies, nil
 }
 
 func GetCrawler(name string) Crawler {
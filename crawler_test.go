@@ -1,8 +1,388 @@
 package wasgeit
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Fixtures are HTML snapshots of the venue pages as written by crawlerhelper into ./tmp/, following pages of paginated
+// programmes are stored as <crawler>-2.html and so on. To add or refresh a fixture, copy tmp/<crawler>*.html to
+// testdata/fixtures/ and regenerate the goldens with:
+//
+//	go test -run TestCrawlerFixtures -update
+var updateGoldens = flag.Bool("update", false, "Rewrite golden files in testdata/golden")
+
+const (
+	fixtureDir = "testdata/fixtures"
+	goldenDir  = "testdata/golden"
 )
 
-func TestBla(t *testing.T) {
+// fixtureTime is the frozen "now" all fixtures are crawled at.
+var fixtureTime = time.Date(2019, time.June, 10, 12, 0, 0, 0, location)
+
+type goldenResult struct {
+	Events []goldenEvent `json:"events"`
+	Errors []string      `json:"errors"`
+}
+
+type goldenEvent struct {
+	Title    string    `json:"title"`
+	DateTime time.Time `json:"datetime"`
+	URL      string    `json:"url"`
+	// Status is left out for scheduled events
+	Status EventStatus `json:"status,omitempty"`
+}
+
+func TestCrawlerFixtures(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+	st.Clock = FixedClock(fixtureTime)
+
+	htmlCrawlers, err := NewHTMLCrawlers(st, "crawlers")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cr := range htmlCrawlers {
+		cr := cr
+		t.Run(cr.Name(), func(t *testing.T) {
+			pages := readFixturePages(t, cr.Name())
+
+			// crawlers without the browser read their fixtures as served over HTTP, as the fixtures hold the markup
+			// as the venue serves it
+			if cr.FetchMode() == FetchWithHTTP {
+				pages = serveFixturePages(t, cr, pages)
+			}
+
+			if err := cr.Read(pages...); err != nil {
+				t.Fatal(err)
+			}
+
+			actual := toGoldenResult(cr.GetEvents())
+			goldenFile := filepath.Join(goldenDir, cr.Name()+".json")
+
+			if *updateGoldens {
+				writeGolden(t, goldenFile, actual)
+				return
+			}
+
+			var expected goldenResult
+			readGolden(t, goldenFile, &expected)
+
+			if len(actual.Events) == 0 {
+				t.Error("fixture yielded no events")
+			}
+
+			assertSameJSON(t, expected, actual)
+		})
+	}
+}
+
+func readFixturePages(t *testing.T, name string) []string {
+	body, err := ioutil.ReadFile(filepath.Join(fixtureDir, name+".html"))
+
+	if err != nil {
+		t.Fatalf("every crawler needs a fixture: %v", err)
+	}
+
+	bodies := []string{string(body)}
+
+	for page := 2; ; page++ {
+		body, err := ioutil.ReadFile(filepath.Join(fixtureDir, fmt.Sprintf("%s-%d.html", name, page)))
+
+		if os.IsNotExist(err) {
+			return bodies
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		bodies = append(bodies, string(body))
+	}
+}
+
+// serveFixturePages fetches the pages of the crawler with an HTTPFetcher from a server answering each request with the
+// next fixture page.
+func serveFixturePages(t *testing.T, cr Crawler, pages []string) []string {
+	served := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if served == len(pages) {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, pages[served])
+		served++
+	}))
+	defer server.Close()
+
+	target, err := url.Parse(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := NewHTTPFetcher()
+	fetcher.Client.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		r.URL.Scheme, r.URL.Host = target.Scheme, target.Host
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	bodies, err := FetchPages(context.Background(), cr, fetcher)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if served != len(pages) {
+		t.Fatalf("expected all %d fixture pages to be fetched, got %d", len(pages), served)
+	}
+
+	return bodies
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func toGoldenResult(events []Event, errors []error) goldenResult {
+	result := goldenResult{Events: []goldenEvent{}, Errors: []string{}}
+
+	for _, ev := range events {
+		result.Events = append(result.Events, goldenEvent{Title: ev.Title, DateTime: ev.DateTime, URL: ev.URL, Status: goldenStatus(ev.Status)})
+	}
+
+	for _, err := range errors {
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	return result
+}
+
+func goldenStatus(status EventStatus) EventStatus {
+	if status == StatusScheduled {
+		return ""
+	}
+	return status
+}
+
+func newTestStore(t *testing.T) *Store {
+	db, err := sql.Open("sqlite3", ":memory:")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every connection to :memory: opens a new database
+	db.SetMaxOpenConns(1)
+
+	st := newStore(db, sqliteDialect{})
+
+	if err := st.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	return st
+}
+
+func testVenue(t *testing.T, st Storage, shortName string) Venue {
+	venue, err := st.FindVenue(shortName)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return venue
+}
+
+func testEvents(t *testing.T, st Storage, crawlerName string) []Event {
+	events, err := st.FindEvents(crawlerName)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return events
+}
+
+func testEventsYetToHappen(t *testing.T, st Storage) []Event {
+	events, err := st.GetEventsYetToHappen()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return events
+}
+
+func testEventsAddedDuringLastWeek(t *testing.T, st Storage) []Event {
+	events, err := st.GetEventsAddedDuringLastWeek()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return events
+}
+
+func readGolden(t *testing.T, filename string, v interface{}) {
+	content, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		t.Fatalf("could not read golden file, run with -update to create it: %v", err)
+	}
+
+	if err := json.Unmarshal(content, v); err != nil {
+		t.Fatalf("could not parse golden file %q: %v", filename, err)
+	}
+}
+
+func writeGolden(t *testing.T, filename string, v interface{}) {
+	content, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filename, append(content, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertSameJSON(t *testing.T, expected interface{}, actual interface{}) {
+	expectedJSON, _ := json.MarshalIndent(expected, "", "  ")
+	actualJSON, _ := json.MarshalIndent(actual, "", "  ")
+
+	if string(expectedJSON) != string(actualJSON) {
+		t.Error(fmt.Sprintf("expected:\n%s\nactual:\n%s", expectedJSON, actualJSON))
+	}
+}
+
+type fakeFetcher map[string]string
+
+func (f fakeFetcher) Fetch(_ context.Context, url string) (string, error) {
+	if body, exists := f[url]; exists {
+		return body, nil
+	}
+	return "", fmt.Errorf("unexpected fetch of %s", url)
+}
+
+// TestAssetsOutsideRepository sets up a database and the built-in crawlers from a directory without the SQL scripts
+// and the crawler definitions, as in the containers.
+func TestAssetsOutsideRepository(t *testing.T) {
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	st := newTestStore(t)
+	defer st.Close()
+
+	if version, err := st.SchemaVersion(); err != nil || version != schemaVersion {
+		t.Errorf("expected schema version %d, got %d (%v)", schemaVersion, version, err)
+	}
+
+	if crawlers, err := NewHTMLCrawlers(st, ""); err != nil || len(crawlers) == 0 {
+		t.Errorf("expected the built-in crawlers, got %d (%v)", len(crawlers), err)
+	}
+}
+
+func TestFetchPages(t *testing.T) {
+	config := HTMLConfig{
+		EventSelector:     ".event",
+		TitleSelector:     "h2",
+		TimeFormat:        "02.01.2006",
+		GetDateTimeString: func(s *goquery.Selection) (string, error) { return s.Find("time").Text(), nil },
+		LinkBuilder:       func(_ Venue, s *goquery.Selection) string { return s.Find("a").AttrOr("href", "") },
+		Identity:          urlIdentity,
+	}
+	page := func(next string, urls ...string) string {
+		body := ""
+		for _, url := range urls {
+			body += fmt.Sprintf(`<div class="event"><h2>%s</h2><time>01.07.2019</time><a href="%s"></a></div>`, url, url)
+		}
+		if next != "" {
+			body += fmt.Sprintf(`<a class="next" href="%s">next</a>`, next)
+		}
+		return body
+	}
+
+	t.Run("next link", func(t *testing.T) {
+		config := config
+		config.Pagination = Pagination{NextSelector: ".next"}
+		cr := &HTMLCrawler{venue: Venue{URL: "https://example.org/agenda"}, config: config, clock: FixedClock(fixtureTime)}
+
+		bodies, err := FetchPages(context.Background(), cr, fakeFetcher{
+			"https://example.org/agenda":        page("?page=2", "/a", "/b"),
+			"https://example.org/agenda?page=2": page("/agenda", "/b", "/c"),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(bodies) != 2 {
+			t.Fatalf("expected 2 pages, got %d", len(bodies))
+		}
+
+		if err := cr.Read(bodies...); err != nil {
+			t.Fatal(err)
+		}
+
+		evs, errs := cr.GetEvents()
+
+		if len(errs) != 0 || len(evs) != 3 {
+			t.Errorf("expected 3 events without errors, got %v and %v", evs, errs)
+		}
+	})
+
+	t.Run("url template", func(t *testing.T) {
+		config := config
+		config.Pagination = Pagination{
+			URLTemplate: template.Must(template.New("url").Parse("https://example.org/{{.Year}}/{{.Month}}")),
+			Months:      3,
+		}
+		cr := &HTMLCrawler{venue: Venue{URL: "https://example.org/"}, config: config, clock: FixedClock(fixtureTime)}
+
+		bodies, err := FetchPages(context.Background(), cr, fakeFetcher{
+			"https://example.org/2019/6": page(""),
+			"https://example.org/2019/7": page(""),
+			"https://example.org/2019/8": page(""),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(bodies) != 3 {
+			t.Errorf("expected 3 pages, got %d", len(bodies))
+		}
+	})
 }
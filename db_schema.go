@@ -2,7 +2,6 @@ package wasgeit
 
 import (
 	"fmt"
-	"io/ioutil"
 )
 
 func (store *Store) DropTables() error {
@@ -10,32 +9,13 @@ func (store *Store) DropTables() error {
 		return fmt.Errorf("need to connect to DB first")
 	}
 
-	drop := readFile("sql/drop.sql")
-
-	_, err := store.db.Exec(drop)
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (store *Store) CreateTables() error {
-	if store.db == nil {
-		return fmt.Errorf("need to connect to DB first")
-	}
-
-	schema := readFile("sql/create-schema.sql")
-	venues := readFile("sql/insert-venues.sql")
-
-	_, err := store.db.Exec(schema)
+	drop, err := readAsset(store.db.dialect.scripts().drop)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = store.db.Exec(venues)
+	_, err = store.db.Exec(drop)
 
 	if err != nil {
 		return err
@@ -44,12 +24,7 @@ func (store *Store) CreateTables() error {
 	return nil
 }
 
-func readFile(filename string) string {
-	schema, err := ioutil.ReadFile(filename)
-
-	if err != nil {
-		panic(err)
-	}
-
-	return string(schema[:])
+// CreateTables sets up the schema of this build along with the search index, see Migrate.
+func (store *Store) CreateTables() error {
+	return store.Migrate()
 }
@@ -0,0 +1,623 @@
+package wasgeit
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v2"
+)
+
+// CrawlerDefinition is the file representation of an HTMLConfig. Definitions are written in YAML or JSON and
+// compiled into an HTMLConfig when the crawlers are registered, so venues can be added or fixed without recompiling.
+type CrawlerDefinition struct {
+	// Name is the short name of the venue. Defaults to the file name without its extension.
+	Name          string            `yaml:"name"`
+	EventSelector string            `yaml:"event_selector"`
+	TitleSelector string            `yaml:"title_selector"`
+	TimeFormat    string            `yaml:"time_format"`
+	DateTime      []ValueDefinition `yaml:"date_time"`
+	Link          LinkDefinition    `yaml:"link"`
+	// Dedupe is either "url" (the default) or "title-and-date".
+	Dedupe string `yaml:"dedupe"`
+	// Fetcher is either "browser" (the default) or "http".
+	Fetcher    string               `yaml:"fetcher"`
+	Wait       WaitDefinition       `yaml:"wait"`
+	Pagination PaginationDefinition `yaml:"pagination"`
+	Status     StatusDefinition     `yaml:"status"`
+	Details    *DetailsDefinition   `yaml:"details"`
+}
+
+// ValueDefinition extracts a string from an event. The extracted value is either a literal or the text (or attribute)
+// of the element matched by Selector, which is then passed through Steps in order. DateTime values are concatenated.
+type ValueDefinition struct {
+	// Selector is evaluated relative to the event, an empty selector denotes the event itself.
+	Selector string `yaml:"selector"`
+	// Parents is the number of levels to walk up from the selected element.
+	Parents int              `yaml:"parents"`
+	Attr    string           `yaml:"attr"`
+	Literal string           `yaml:"literal"`
+	Steps   []StepDefinition `yaml:"steps"`
+}
+
+// StepDefinition is a single string transformation, exactly one of its fields may be set.
+type StepDefinition struct {
+	StripWhitespace bool             `yaml:"strip_whitespace"`
+	Trim            bool             `yaml:"trim"`
+	Replace         []string         `yaml:"replace"`
+	Split           *SplitDefinition `yaml:"split"`
+	Regex           string           `yaml:"regex"`
+	Group           int              `yaml:"group"`
+	Slice           []int            `yaml:"slice"`
+}
+
+// WaitDefinition is the file representation of a WaitCondition.
+type WaitDefinition struct {
+	Visible        string        `yaml:"visible"`
+	NetworkIdle    bool          `yaml:"network_idle"`
+	ScrollToBottom bool          `yaml:"scroll_to_bottom"`
+	LoadMore       string        `yaml:"load_more"`
+	MaxLoadMore    int           `yaml:"max_load_more"`
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+// PaginationDefinition is the file representation of a Pagination.
+type PaginationDefinition struct {
+	Next        string `yaml:"next"`
+	URLTemplate string `yaml:"url_template"`
+	Months      int    `yaml:"months"`
+	MaxPages    int    `yaml:"max_pages"`
+}
+
+// StatusDefinition is the file representation of a StatusConfig, its maps are keyed by status, e.g. "sold-out".
+type StatusDefinition struct {
+	Keywords map[EventStatus][]string `yaml:"keywords"`
+	Markers  map[EventStatus]string   `yaml:"markers"`
+	Selector string                   `yaml:"selector"`
+}
+
+// DetailsDefinition is the file representation of Details. Its values are evaluated against the whole detail page.
+type DetailsDefinition struct {
+	Description *ValueDefinition     `yaml:"description"`
+	Price       *ValueDefinition     `yaml:"price"`
+	Doors       *ValueDefinition     `yaml:"doors"`
+	Start       *ValueDefinition     `yaml:"start"`
+	End         *ValueDefinition     `yaml:"end"`
+	Genres      *ListValueDefinition `yaml:"genres"`
+	Support     *ListValueDefinition `yaml:"support"`
+	Image       *ValueDefinition     `yaml:"image"`
+	Tickets     *ValueDefinition     `yaml:"tickets"`
+	TimeFormat  string               `yaml:"time_format"`
+	// Fetcher defaults to the fetcher of the listing.
+	Fetcher string         `yaml:"fetcher"`
+	Wait    WaitDefinition `yaml:"wait"`
+	MaxAge  time.Duration  `yaml:"max_age"`
+}
+
+// ListValueDefinition extracts a value from every element matched by its selector, optionally splitting each of them
+// by Separator.
+type ListValueDefinition struct {
+	ValueDefinition `yaml:",inline"`
+	Separator       string `yaml:"separator"`
+}
+
+type SplitDefinition struct {
+	Separator string `yaml:"separator"`
+	Index     int    `yaml:"index"`
+}
+
+// LinkDefinition describes how the URL of an event is built. Supported strategies are:
+//
+//	attribute:        value of Attr (default "href"), falls back to the venue URL
+//	resolve-relative: value of Attr (default "href") resolved against the venue URL, falls back to the venue URL
+//	anchor-id:        venue URL with the value of Attr (default "id") as fragment
+//	append:           venue URL with the value of Attr (default "href") appended
+type LinkDefinition struct {
+	Strategy string `yaml:"strategy"`
+	Selector string `yaml:"selector"`
+	Parents  int    `yaml:"parents"`
+	Attr     string `yaml:"attr"`
+}
+
+var definitionExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// LoadCrawlerDefinitions reads all crawler definitions (*.yaml, *.yml and *.json) in dir, sorted by file name. The
+// built-in definitions are read if dir is empty.
+func LoadCrawlerDefinitions(dir string) ([]CrawlerDefinition, error) {
+	if dir == "" {
+		return loadCrawlerDefinitions(assets, "crawlers")
+	}
+	return loadCrawlerDefinitions(os.DirFS(dir), ".")
+}
+
+func loadCrawlerDefinitions(fsys fs.FS, dir string) ([]CrawlerDefinition, error) {
+	files, err := fs.ReadDir(fsys, dir)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read crawler definitions: %v", err)
+	}
+
+	var defs []CrawlerDefinition
+	seen := make(map[string]string)
+
+	// ReadDir sorts the files by name
+	for _, file := range files {
+		ext := path.Ext(file.Name())
+		if file.IsDir() || !definitionExtensions[ext] {
+			continue
+		}
+
+		def, err := readCrawlerDefinition(fsys, path.Join(dir, file.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if other, exists := seen[def.Name]; exists {
+			return nil, fmt.Errorf("crawler %q is defined in both %q and %q", def.Name, other, file.Name())
+		}
+		seen[def.Name] = file.Name()
+
+		defs = append(defs, def)
+	}
+
+	return defs, nil
+}
+
+// ReadCrawlerDefinition reads a single crawler definition. YAML is a superset of JSON, so both are parsed alike.
+func ReadCrawlerDefinition(filename string) (CrawlerDefinition, error) {
+	return readCrawlerDefinition(os.DirFS(filepath.Dir(filename)), filepath.Base(filename))
+}
+
+func readCrawlerDefinition(fsys fs.FS, name string) (CrawlerDefinition, error) {
+	var def CrawlerDefinition
+
+	content, err := fs.ReadFile(fsys, name)
+
+	if err != nil {
+		return def, err
+	}
+
+	if err := yaml.UnmarshalStrict(content, &def); err != nil {
+		return def, fmt.Errorf("could not parse crawler definition %q: %v", name, err)
+	}
+
+	if def.Name == "" {
+		base := path.Base(name)
+		def.Name = strings.TrimSuffix(base, path.Ext(base))
+	}
+
+	return def, nil
+}
+
+// Compile turns the definition into an HTMLConfig.
+func (def CrawlerDefinition) Compile() (HTMLConfig, error) {
+	config := HTMLConfig{
+		EventSelector: def.EventSelector,
+		TitleSelector: def.TitleSelector,
+		TimeFormat:    def.TimeFormat,
+	}
+
+	if def.EventSelector == "" || def.TitleSelector == "" || def.TimeFormat == "" {
+		return config, def.errorf("event_selector, title_selector and time_format are required")
+	}
+
+	if len(def.DateTime) == 0 {
+		return config, def.errorf("date_time needs at least one value")
+	}
+
+	var parts []func(*goquery.Selection) (string, error)
+	for i, value := range def.DateTime {
+		extract, err := value.compile()
+
+		if err != nil {
+			return config, def.errorf("date_time[%d]: %v", i, err)
+		}
+		parts = append(parts, extract)
+	}
+
+	config.GetDateTimeString = func(eventSelection *goquery.Selection) (string, error) {
+		var dateTimeString string
+		for _, extract := range parts {
+			part, err := extract(eventSelection)
+
+			if err != nil {
+				return "", err
+			}
+			dateTimeString += part
+		}
+		return dateTimeString, nil
+	}
+
+	linkBuilder, err := def.Link.compile()
+
+	if err != nil {
+		return config, def.errorf("link: %v", err)
+	}
+	config.LinkBuilder = linkBuilder
+
+	switch def.Dedupe {
+	case "", "url":
+		config.Identity = urlIdentity
+	case "title-and-date":
+		config.Identity = titleAndDateIdentity
+	default:
+		return config, def.errorf("unknown dedupe strategy %q", def.Dedupe)
+	}
+
+	switch mode := FetchMode(def.Fetcher); mode {
+	case "", FetchWithBrowser, FetchWithHTTP:
+		config.FetchMode = mode
+	default:
+		return config, def.errorf("unknown fetcher %q", def.Fetcher)
+	}
+
+	config.Wait = WaitCondition(def.Wait)
+
+	pagination, err := def.Pagination.compile()
+
+	if err != nil {
+		return config, def.errorf("pagination: %v", err)
+	}
+	config.Pagination = pagination
+
+	status, err := def.Status.compile()
+
+	if err != nil {
+		return config, def.errorf("status: %v", err)
+	}
+	config.Status = status
+
+	if def.Details != nil {
+		details, err := def.Details.compile()
+
+		if err != nil {
+			return config, def.errorf("details: %v", err)
+		}
+		config.Details = &details
+	}
+
+	return config, nil
+}
+
+func (def CrawlerDefinition) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("crawler %q: %s", def.Name, fmt.Sprintf(format, args...))
+}
+
+func (pagination PaginationDefinition) compile() (Pagination, error) {
+	compiled := Pagination{NextSelector: pagination.Next, Months: pagination.Months, MaxPages: pagination.MaxPages}
+
+	if pagination.Next != "" && pagination.URLTemplate != "" {
+		return compiled, fmt.Errorf("either next or url_template may be set")
+	}
+
+	if pagination.URLTemplate != "" {
+		tmpl, err := template.New("url").Option("missingkey=error").Parse(pagination.URLTemplate)
+
+		if err != nil {
+			return compiled, err
+		}
+		compiled.URLTemplate = tmpl
+	}
+
+	return compiled, nil
+}
+
+func (status StatusDefinition) compile() (StatusConfig, error) {
+	for s := range status.Keywords {
+		if !isDetectableStatus(s) {
+			return StatusConfig{}, fmt.Errorf("unknown status %q in keywords", s)
+		}
+	}
+
+	for s := range status.Markers {
+		if !isDetectableStatus(s) {
+			return StatusConfig{}, fmt.Errorf("unknown status %q in markers", s)
+		}
+	}
+
+	return NewStatusConfig(status.Keywords, status.Markers, status.Selector), nil
+}
+
+func (details DetailsDefinition) compile() (Details, error) {
+	compiled := Details{TimeFormat: details.TimeFormat, Wait: WaitCondition(details.Wait), MaxAge: details.MaxAge}
+
+	switch mode := FetchMode(details.Fetcher); mode {
+	case "", FetchWithBrowser, FetchWithHTTP:
+		compiled.FetchMode = mode
+	default:
+		return compiled, fmt.Errorf("unknown fetcher %q", details.Fetcher)
+	}
+
+	values := []struct {
+		name   string
+		value  *ValueDefinition
+		target *func(*goquery.Selection) (string, error)
+	}{
+		{"description", details.Description, &compiled.Description},
+		{"price", details.Price, &compiled.Price},
+		{"doors", details.Doors, &compiled.Doors},
+		{"start", details.Start, &compiled.Start},
+		{"end", details.End, &compiled.End},
+		{"image", details.Image, &compiled.ImageURL},
+		{"tickets", details.Tickets, &compiled.TicketURL},
+	}
+
+	for _, v := range values {
+		if v.value == nil {
+			continue
+		}
+
+		extract, err := v.value.compile()
+
+		if err != nil {
+			return compiled, fmt.Errorf("%s: %v", v.name, err)
+		}
+		*v.target = extract
+	}
+
+	lists := []struct {
+		name   string
+		value  *ListValueDefinition
+		target *func(*goquery.Selection) ([]string, error)
+	}{
+		{"genres", details.Genres, &compiled.Genres},
+		{"support", details.Support, &compiled.Support},
+	}
+
+	for _, l := range lists {
+		if l.value == nil {
+			continue
+		}
+
+		extract, err := l.value.compileList(l.value.Separator)
+
+		if err != nil {
+			return compiled, fmt.Errorf("%s: %v", l.name, err)
+		}
+		*l.target = extract
+	}
+
+	return compiled, nil
+}
+
+func (value ValueDefinition) compile() (func(*goquery.Selection) (string, error), error) {
+	transform, err := value.compileSteps()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(eventSelection *goquery.Selection) (string, error) {
+		if value.Literal != "" {
+			return transform(value.Literal)
+		}
+		return transform(value.read(selectRelative(eventSelection, value.Selector, value.Parents)))
+	}, nil
+}
+
+// compileList is like compile, except that every element matched by Selector yields a value of its own. Values are
+// further split by separator if it is not empty, empty values are dropped.
+func (value ValueDefinition) compileList(separator string) (func(*goquery.Selection) ([]string, error), error) {
+	transform, err := value.compileSteps()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return func(eventSelection *goquery.Selection) ([]string, error) {
+		var raw []string
+
+		if value.Literal != "" {
+			raw = append(raw, value.Literal)
+		} else {
+			selectRelative(eventSelection, value.Selector, value.Parents).Each(func(_ int, selection *goquery.Selection) {
+				raw = append(raw, value.read(selection))
+			})
+		}
+
+		var values []string
+		for _, s := range raw {
+			s, err := transform(s)
+
+			if err != nil {
+				return nil, err
+			}
+
+			tokens := []string{s}
+			if separator != "" {
+				tokens = strings.Split(s, separator)
+			}
+
+			for _, token := range tokens {
+				if token = strings.TrimSpace(StripLineBreaks(token)); token != "" {
+					values = append(values, token)
+				}
+			}
+		}
+
+		return values, nil
+	}, nil
+}
+
+func (value ValueDefinition) read(selection *goquery.Selection) string {
+	if value.Attr != "" {
+		return selection.AttrOr(value.Attr, "")
+	}
+	return selection.Text()
+}
+
+// compileSteps chains all steps into a single transformation.
+func (value ValueDefinition) compileSteps() (func(string) (string, error), error) {
+	var steps []func(string) (string, error)
+
+	for i, step := range value.Steps {
+		compiled, err := step.compile()
+
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %v", i, err)
+		}
+		steps = append(steps, compiled)
+	}
+
+	return func(s string) (string, error) {
+		for _, step := range steps {
+			var err error
+			if s, err = step(s); err != nil {
+				return "", err
+			}
+		}
+		return s, nil
+	}, nil
+}
+
+func (step StepDefinition) compile() (func(string) (string, error), error) {
+	var compiled []func(string) (string, error)
+
+	if step.StripWhitespace {
+		compiled = append(compiled, func(s string) (string, error) {
+			return StripSomeWhiteSpaces(s), nil
+		})
+	}
+
+	if step.Trim {
+		compiled = append(compiled, func(s string) (string, error) {
+			return strings.TrimSpace(s), nil
+		})
+	}
+
+	if len(step.Replace) > 0 {
+		if len(step.Replace)%2 != 0 {
+			return nil, fmt.Errorf("replace needs pairs of old and new values")
+		}
+		replacer := strings.NewReplacer(step.Replace...)
+		compiled = append(compiled, func(s string) (string, error) {
+			return replacer.Replace(s), nil
+		})
+	}
+
+	if step.Split != nil {
+		split := *step.Split
+		compiled = append(compiled, func(s string) (string, error) {
+			tokens := strings.Split(s, split.Separator)
+			if split.Index >= len(tokens) {
+				return "", fmt.Errorf("splitting %q by %q yielded no token %d", s, split.Separator, split.Index)
+			}
+			return tokens[split.Index], nil
+		})
+	}
+
+	if step.Regex != "" {
+		re, err := regexp.Compile(step.Regex)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if step.Group > re.NumSubexp() {
+			return nil, fmt.Errorf("regex %q has no group %d", step.Regex, step.Group)
+		}
+
+		group := step.Group
+		compiled = append(compiled, func(s string) (string, error) {
+			if captures := re.FindStringSubmatch(s); captures != nil {
+				return captures[group], nil
+			}
+			return "", nil
+		})
+	} else if step.Group != 0 {
+		return nil, fmt.Errorf("group requires a regex")
+	}
+
+	if step.Slice != nil {
+		if len(step.Slice) < 1 || len(step.Slice) > 2 {
+			return nil, fmt.Errorf("slice needs a start and an optional end")
+		}
+		bounds := step.Slice
+		compiled = append(compiled, func(s string) (string, error) {
+			start, end := bounds[0], len(s)
+			if len(bounds) == 2 {
+				end = bounds[1]
+			}
+			if start < 0 || start > end || end > len(s) {
+				return "", fmt.Errorf("cannot slice %q from %d to %d", s, start, end)
+			}
+			return s[start:end], nil
+		})
+	}
+
+	if len(compiled) != 1 {
+		return nil, fmt.Errorf("exactly one operation per step expected, got %d", len(compiled))
+	}
+
+	return compiled[0], nil
+}
+
+func (link LinkDefinition) compile() (func(Venue, *goquery.Selection) string, error) {
+	attrOrDefault := func(defaultAttr string) string {
+		if link.Attr != "" {
+			return link.Attr
+		}
+		return defaultAttr
+	}
+
+	switch link.Strategy {
+	case "attribute":
+		attr := attrOrDefault("href")
+		return func(venue Venue, eventSelection *goquery.Selection) string {
+			return selectRelative(eventSelection, link.Selector, link.Parents).AttrOr(attr, venue.URL)
+		}, nil
+	case "resolve-relative":
+		attr := attrOrDefault("href")
+		return func(venue Venue, eventSelection *goquery.Selection) string {
+			if href, exists := selectRelative(eventSelection, link.Selector, link.Parents).Attr(attr); exists {
+				return resolveRelative(venue.URL, href)
+			}
+			return venue.URL
+		}, nil
+	case "anchor-id":
+		attr := attrOrDefault("id")
+		return func(venue Venue, eventSelection *goquery.Selection) string {
+			id := selectRelative(eventSelection, link.Selector, link.Parents).AttrOr(attr, "")
+			return fmt.Sprintf("%s#%s", venue.URL, id)
+		}, nil
+	case "append":
+		attr := attrOrDefault("href")
+		return func(venue Venue, eventSelection *goquery.Selection) string {
+			return fmt.Sprint(venue.URL, selectRelative(eventSelection, link.Selector, link.Parents).AttrOr(attr, ""))
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown link strategy %q", link.Strategy)
+	}
+}
+
+func selectRelative(eventSelection *goquery.Selection, selector string, parents int) *goquery.Selection {
+	selection := eventSelection
+	if selector != "" {
+		selection = selection.Find(selector)
+	}
+	for i := 0; i < parents; i++ {
+		selection = selection.Parent()
+	}
+	return selection
+}
+
+func resolveRelative(baseURL string, href string) string {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL
+	}
+	relative, err := url.Parse(href)
+	if err != nil {
+		return baseURL
+	}
+	return base.ResolveReference(relative).String()
+}
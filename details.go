@@ -0,0 +1,341 @@
+package wasgeit
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	defaultDetailsTimeFormat = "15:04"
+	defaultDetailsMaxAge     = 24 * time.Hour
+)
+
+// Details describes how the detail page of an event, i.e. the page its URL points to, is scraped. Unlike the listing
+// selectors, the selectors of the detail page are evaluated against the whole page. Extractors left nil are skipped.
+type Details struct {
+	Description func(*goquery.Selection) (string, error)
+	Price       func(*goquery.Selection) (string, error)
+	// Doors, Start and End yield a time of day in TimeFormat, Start replaces the time of the event read from the listing
+	Doors     func(*goquery.Selection) (string, error)
+	Start     func(*goquery.Selection) (string, error)
+	End       func(*goquery.Selection) (string, error)
+	Genres    func(*goquery.Selection) ([]string, error)
+	Support   func(*goquery.Selection) ([]string, error)
+	ImageURL  func(*goquery.Selection) (string, error)
+	TicketURL func(*goquery.Selection) (string, error)
+	// TimeFormat of Doors and Start, defaults to 15:04
+	TimeFormat string
+	// FetchMode defaults to the FetchMode of the listing
+	FetchMode FetchMode
+	Wait      WaitCondition
+	// MaxAge is how long a fetched detail page is used without asking the site again, defaults to a day
+	MaxAge time.Duration
+}
+
+// EventDetails are the fields read from the detail page of an event. Times of day are kept as "15:04" so they can be
+// applied to the event even if its date changed since the page was cached.
+type EventDetails struct {
+	Description string      `json:"description,omitempty"`
+	Price       *PriceRange `json:"price_range,omitempty"`
+	Doors       string      `json:"doors,omitempty"`
+	Start       string      `json:"start,omitempty"`
+	End         string      `json:"end,omitempty"`
+	Genres      []string    `json:"genres,omitempty"`
+	Support     []string    `json:"support,omitempty"`
+	ImageURL    string      `json:"image_url,omitempty"`
+	TicketURL   string      `json:"ticket_url,omitempty"`
+}
+
+// CachedDetails is a detail page read before, see Store.FindEventDetails.
+type CachedDetails struct {
+	URL        string
+	Details    EventDetails
+	Validators Validators
+	Fetched    time.Time
+}
+
+// DetailCache looks up detail pages read during earlier crawls.
+type DetailCache interface {
+	FindEventDetails(url string) (CachedDetails, bool, error)
+}
+
+// DetailCrawler is implemented by crawlers able to read the detail pages of their events.
+type DetailCrawler interface {
+	Crawler
+	HasDetails() bool
+	DetailFetchMode() FetchMode
+	DetailWaitCondition() WaitCondition
+	DetailsMaxAge() time.Duration
+	ReadDetails(pageURL string, body string) (EventDetails, error)
+}
+
+func (cr *HTMLCrawler) HasDetails() bool {
+	return cr.config.Details != nil
+}
+
+func (cr *HTMLCrawler) DetailFetchMode() FetchMode {
+	if cr.config.Details != nil && cr.config.Details.FetchMode != "" {
+		return cr.config.Details.FetchMode
+	}
+	return cr.FetchMode()
+}
+
+func (cr *HTMLCrawler) DetailWaitCondition() WaitCondition {
+	if cr.config.Details == nil {
+		return WaitCondition{}
+	}
+	return cr.config.Details.Wait
+}
+
+func (cr *HTMLCrawler) DetailsMaxAge() time.Duration {
+	if cr.config.Details == nil || cr.config.Details.MaxAge <= 0 {
+		return defaultDetailsMaxAge
+	}
+	return cr.config.Details.MaxAge
+}
+
+// ReadDetails extracts the details from the body of a detail page. Fields which could not be read are reported in the
+// returned error, the other fields are returned nonetheless.
+func (cr *HTMLCrawler) ReadDetails(pageURL string, body string) (EventDetails, error) {
+	var details EventDetails
+	config := cr.config.Details
+
+	if config == nil {
+		return details, fmt.Errorf("crawler %q has no details configured", cr.Name())
+	}
+
+	dom, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+
+	if err != nil {
+		return details, err
+	}
+
+	page := dom.Selection
+	var failed []string
+
+	readString := func(name string, extract func(*goquery.Selection) (string, error), target *string) {
+		if extract == nil {
+			return
+		}
+		value, err := extract(page)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		*target = strings.TrimSpace(StripLineBreaks(value))
+	}
+
+	readList := func(name string, extract func(*goquery.Selection) ([]string, error), target *[]string) {
+		if extract == nil {
+			return
+		}
+		values, err := extract(page)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		*target = values
+	}
+
+	readTime := func(name string, extract func(*goquery.Selection) (string, error), target *string) {
+		var value string
+		if readString(name, extract, &value); value == "" {
+			return
+		}
+		timeOfDay, err := parseTimeOfDay(config.TimeFormat, value)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		*target = timeOfDay
+	}
+
+	readURL := func(name string, extract func(*goquery.Selection) (string, error), target *string) {
+		var value string
+		if readString(name, extract, &value); value != "" {
+			*target = resolveRelative(pageURL, value)
+		}
+	}
+
+	var price string
+	readString("description", config.Description, &details.Description)
+	readString("price", config.Price, &price)
+	readTime("doors", config.Doors, &details.Doors)
+	readTime("start", config.Start, &details.Start)
+	readTime("end", config.End, &details.End)
+	readList("genres", config.Genres, &details.Genres)
+	readList("support", config.Support, &details.Support)
+	readURL("image", config.ImageURL, &details.ImageURL)
+	readURL("tickets", config.TicketURL, &details.TicketURL)
+
+	if price != "" {
+		if details.Price, err = ParsePrice(price); err != nil {
+			failed = append(failed, fmt.Sprintf("price: %v", err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return details, fmt.Errorf("reading details of %q failed: %s", pageURL, strings.Join(failed, ", "))
+	}
+
+	return details, nil
+}
+
+func parseTimeOfDay(format string, value string) (string, error) {
+	if format == "" {
+		format = defaultDetailsTimeFormat
+	}
+
+	parsed, err := time.Parse(format, value)
+
+	if err != nil {
+		return "", err
+	}
+
+	return parsed.Format(defaultDetailsTimeFormat), nil
+}
+
+// WithDetails returns a copy of the event carrying the given details.
+func (ev Event) WithDetails(details EventDetails) Event {
+	ev.Description = details.Description
+	ev.Price = details.Price
+	ev.Genres = details.Genres
+	ev.Support = details.Support
+	ev.ImageURL = details.ImageURL
+	ev.TicketURL = details.TicketURL
+
+	if doors, ok := atTimeOfDay(ev.DateTime, details.Doors); ok {
+		ev.Doors = doors
+	}
+
+	if start, ok := atTimeOfDay(ev.DateTime, details.Start); ok {
+		ev.DateTime = start
+	}
+
+	if end, ok := atTimeOfDay(ev.DateTime, details.End); ok {
+		// events ending after midnight
+		if end.Before(ev.DateTime) {
+			end = end.AddDate(0, 0, 1)
+		}
+		ev.EndDateTime = end
+	}
+
+	return ev
+}
+
+func atTimeOfDay(day time.Time, timeOfDay string) (time.Time, bool) {
+	parsed, err := time.Parse(defaultDetailsTimeFormat, timeOfDay)
+
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Date(day.Year(), day.Month(), day.Day(), parsed.Hour(), parsed.Minute(), 0, 0, day.Location()), true
+}
+
+// DetailFetcher enriches events with the fields found on their detail pages.
+type DetailFetcher struct {
+	Fetcher Fetcher
+	Cache   DetailCache
+	Clock   Clock
+}
+
+// Enrich fetches the detail page of each event and applies the details found there. Pages fetched less than the
+// crawler's DetailsMaxAge ago are taken from the cache. Older ones are revalidated with a conditional request if the
+// fetcher supports it, otherwise they are fetched again. The pages actually fetched or revalidated are returned so
+// they can be stored in the cache. Events whose details could not be fetched are returned unchanged.
+func (df DetailFetcher) Enrich(ctxt context.Context, cr DetailCrawler, events []Event) ([]Event, []CachedDetails, []error) {
+	var enriched []Event
+	var fetched []CachedDetails
+	var errors []error
+
+	now := orSystemClock(df.Clock).Now()
+	seen := make(map[string]EventDetails)
+	listingURL := withoutFragment(cr.URL())
+
+	for _, ev := range events {
+		pageURL := withoutFragment(ev.URL)
+
+		if pageURL == "" || pageURL == listingURL {
+			enriched = append(enriched, ev)
+			continue
+		}
+
+		details, exists := seen[pageURL]
+
+		if !exists {
+			cached, refreshed, err := df.details(ctxt, cr, pageURL, now)
+
+			if err != nil {
+				errors = append(errors, err)
+			}
+
+			if cached.URL == "" {
+				enriched = append(enriched, ev)
+				continue
+			}
+
+			if refreshed {
+				fetched = append(fetched, cached)
+			}
+
+			details = cached.Details
+			seen[pageURL] = details
+		}
+
+		enriched = append(enriched, ev.WithDetails(details))
+	}
+
+	return enriched, fetched, errors
+}
+
+// details returns the details of pageURL and whether the site was asked for them. An entry without URL is returned if
+// no details are available at all.
+func (df DetailFetcher) details(ctxt context.Context, cr DetailCrawler, pageURL string, now time.Time) (CachedDetails, bool, error) {
+	cached, exists, err := df.Cache.FindEventDetails(pageURL)
+
+	if err != nil {
+		return CachedDetails{}, false, err
+	}
+
+	if exists && now.Sub(cached.Fetched) < cr.DetailsMaxAge() {
+		return cached, false, nil
+	}
+
+	var body string
+	var validators Validators
+
+	if conditional, ok := df.Fetcher.(conditionalFetcher); ok {
+		body, validators, err = conditional.FetchIfModified(ctxt, pageURL, cached.Validators)
+	} else {
+		body, err = df.Fetcher.Fetch(ctxt, pageURL)
+	}
+
+	if err == ErrNotModified && exists {
+		cached.Fetched = now
+		return cached, true, nil
+	} else if err != nil {
+		// a stale entry is still better than nothing
+		return cached, false, fmt.Errorf("fetching details %q failed: %v", pageURL, err)
+	}
+
+	details, err := cr.ReadDetails(pageURL, body)
+
+	return CachedDetails{URL: pageURL, Details: details, Validators: validators, Fetched: now}, true, err
+}
+
+func withoutFragment(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+
+	if err != nil {
+		return rawURL
+	}
+
+	parsed.Fragment = ""
+	return parsed.String()
+}
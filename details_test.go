@@ -0,0 +1,178 @@
+package wasgeit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const detailsDefinition = `
+description:
+  selector: .description
+price:
+  selector: .price
+doors:
+  selector: .times
+  steps:
+    - regex: 'Türöffnung (\d{1,2}\.\d{2})'
+      group: 1
+start:
+  selector: .times
+  steps:
+    - regex: 'Konzert (\d{1,2}\.\d{2})'
+      group: 1
+genres:
+  selector: .genre
+  separator: /
+support:
+  selector: .support li
+image:
+  selector: meta[property="og:image"]
+  attr: content
+tickets:
+  selector: a.tickets
+  attr: href
+time_format: "15.04"
+fetcher: http
+`
+
+const detailPage = `<html><head><meta property="og:image" content="/img/band.jpg"></head><body>
+<p class="description">Rock from
+  Bern</p>
+<p class="price">CHF 25.–</p>
+<p class="times">Türöffnung 19.30, Konzert 20.30</p>
+<span class="genre">Rock / Indie</span>
+<ul class="support"><li>First Band</li><li> Second Band </li></ul>
+<a class="tickets" href="https://tickets.example.org/42">Tickets</a>
+</body></html>`
+
+func newDetailCrawler(t *testing.T, venueURL string) *HTMLCrawler {
+	var def DetailsDefinition
+
+	if err := yaml.UnmarshalStrict([]byte(detailsDefinition), &def); err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := def.compile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &HTMLCrawler{
+		venue:  Venue{ShortName: "test", URL: venueURL},
+		config: HTMLConfig{Details: &details},
+		clock:  FixedClock(fixtureTime),
+	}
+}
+
+func TestReadDetails(t *testing.T) {
+	cr := newDetailCrawler(t, "https://example.org/")
+
+	details, err := cr.ReadDetails("https://example.org/events/42", detailPage)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := EventDetails{
+		Description: "Rock from Bern",
+		Price:       &PriceRange{Min: 25, Max: 25, Currency: "CHF"},
+		Doors:       "19:30",
+		Start:       "20:30",
+		Genres:      []string{"Rock", "Indie"},
+		Support:     []string{"First Band", "Second Band"},
+		ImageURL:    "https://example.org/img/band.jpg",
+		TicketURL:   "https://tickets.example.org/42",
+	}
+
+	if !reflect.DeepEqual(expected, details) {
+		t.Errorf("expected %+v, got %+v", expected, details)
+	}
+
+	ev := Event{DateTime: time.Date(2019, time.June, 20, 0, 0, 0, 0, location)}.WithDetails(details)
+
+	if !ev.DateTime.Equal(time.Date(2019, time.June, 20, 20, 30, 0, 0, location)) {
+		t.Errorf("start time was not applied: %v", ev.DateTime)
+	}
+
+	if !ev.Doors.Equal(time.Date(2019, time.June, 20, 19, 30, 0, 0, location)) {
+		t.Errorf("doors were not applied: %v", ev.Doors)
+	}
+}
+
+func TestDetailFetcherCache(t *testing.T) {
+	requests := 0
+	conditionalRequests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditionalRequests++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, detailPage)
+	}))
+	defer server.Close()
+
+	st := newTestStore(t)
+	defer st.Close()
+
+	cr := newDetailCrawler(t, server.URL+"/agenda")
+	events := []Event{
+		{Title: "With details", URL: server.URL + "/events/42", DateTime: fixtureTime.Add(24 * time.Hour)},
+		{Title: "Same page", URL: server.URL + "/events/42#second", DateTime: fixtureTime.Add(48 * time.Hour)},
+		{Title: "Listing only", URL: server.URL + "/agenda#43", DateTime: fixtureTime.Add(48 * time.Hour)},
+	}
+
+	crawl := func(now time.Time) []Event {
+		df := DetailFetcher{Fetcher: NewHTTPFetcher(), Cache: st, Clock: FixedClock(now)}
+		enriched, fetched, errs := df.Enrich(context.Background(), cr, events)
+
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+
+		for _, cached := range fetched {
+			if err := st.SaveEventDetails(cached); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return enriched
+	}
+
+	enriched := crawl(fixtureTime)
+
+	if requests != 1 {
+		t.Errorf("expected the detail page to be fetched once, got %d requests", requests)
+	}
+
+	if enriched[0].Price == nil || enriched[1].Price == nil || enriched[2].Price != nil {
+		t.Errorf("details were not applied as expected: %+v", enriched)
+	}
+
+	crawl(fixtureTime.Add(time.Hour))
+
+	if requests != 1 {
+		t.Errorf("expected the cached details to be used, got %d requests", requests)
+	}
+
+	enriched = crawl(fixtureTime.Add(2 * defaultDetailsMaxAge))
+
+	if requests != 2 || conditionalRequests != 1 {
+		t.Errorf("expected a conditional request, got %d requests of which %d conditional", requests, conditionalRequests)
+	}
+
+	if enriched[0].Price == nil {
+		t.Errorf("details of unchanged page were lost: %+v", enriched[0])
+	}
+}
@@ -0,0 +1,268 @@
+package wasgeit
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// dialect covers the differences between the databases supported by Store. Queries are written with ? placeholders
+// and in the SQL understood by all of them, the rest is built by the dialect.
+type dialect interface {
+	// driver is the name of the database/sql driver
+	driver() string
+	// rebind replaces the ? placeholders of a query with the placeholders of the database
+	rebind(query string) string
+	// date turns a time, a column or a placeholder, into its day in UTC
+	date(expr string) string
+	// dateTime turns a time, a column or a placeholder, into a value comparable with other times
+	dateTime(expr string) string
+	// unixTime turns a time into seconds since the epoch
+	unixTime(expr string) string
+	// like is the operator matching patterns regardless of the case
+	like() string
+	// upsert inserts a row, replacing the row with the same key
+	upsert(table string, key string, columns ...string) string
+	// tableExists is a query counting the tables with the name given as argument
+	tableExists() string
+	// columnExists is a query counting the columns of the table, given as first argument, with the name given as second
+	columnExists() string
+	// searchSupported tells whether the database supports the search index of create-search.sql
+	searchSupported(db queryRower) (bool, error)
+	// isConflict tells whether a statement failed as it violates a unique index
+	isConflict(err error) bool
+	scripts() schemaScripts
+}
+
+// schemaScripts locates the SQL scripts of a dialect, see assets.
+type schemaScripts struct {
+	// baselineVersion is the schema version set up by the baseline scripts
+	baselineVersion int
+	baseline        []string
+	migrationsDir   string
+	drop            string
+	// versionTable creates the table recording the applied migrations
+	versionTable string
+}
+
+// dialectOf returns the dialect of a DSN, postgres:// and postgresql:// URLs connect to PostgreSQL, anything else is
+// the path of a SQLite database.
+func dialectOf(dsn string) dialect {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return postgresDialect{}
+	}
+	return sqliteDialect{}
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) driver() string {
+	return "sqlite3"
+}
+
+func (sqliteDialect) rebind(query string) string {
+	return query
+}
+
+func (sqliteDialect) date(expr string) string {
+	return "date(" + expr + ")"
+}
+
+func (sqliteDialect) dateTime(expr string) string {
+	return "datetime(" + expr + ")"
+}
+
+func (sqliteDialect) unixTime(expr string) string {
+	return "strftime('%s', " + expr + ")"
+}
+
+func (sqliteDialect) like() string {
+	// LIKE of SQLite ignores the case of ASCII letters
+	return "LIKE"
+}
+
+func (sqliteDialect) upsert(table string, key string, columns ...string) string {
+	return fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "),
+		placeholders(len(columns)))
+}
+
+func (sqliteDialect) tableExists() string {
+	return `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+}
+
+func (sqliteDialect) columnExists() string {
+	return `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+}
+
+func (sqliteDialect) searchSupported(db queryRower) (bool, error) {
+	var supported bool
+	err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&supported)
+	return supported, err
+}
+
+func (sqliteDialect) isConflict(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+func (sqliteDialect) scripts() schemaScripts {
+	return schemaScripts{
+		baselineVersion: 0,
+		baseline:        []string{"sql/create-schema.sql", "sql/insert-venues.sql"},
+		migrationsDir:   "sql/migrations",
+		drop:            "sql/drop.sql",
+		versionTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied DATETIME
+		)`,
+	}
+}
+
+// postgresBaselineVersion is the schema version PostgreSQL databases start with, the one of the build adding them.
+const postgresBaselineVersion = 6
+
+type postgresDialect struct{}
+
+func (postgresDialect) driver() string {
+	return "postgres"
+}
+
+// rebind numbers the placeholders, question marks within string literals are left alone.
+func (postgresDialect) rebind(query string) string {
+	var b strings.Builder
+	inLiteral := false
+	n := 0
+
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inLiteral = !inLiteral
+		case r == '?' && !inLiteral:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func (d postgresDialect) date(expr string) string {
+	return "CAST(" + d.dateTime(expr) + " AS DATE)"
+}
+
+func (postgresDialect) dateTime(expr string) string {
+	return "(CAST(" + expr + " AS TIMESTAMPTZ) AT TIME ZONE 'UTC')"
+}
+
+func (postgresDialect) unixTime(expr string) string {
+	return "CAST(EXTRACT(EPOCH FROM " + expr + ") AS BIGINT)"
+}
+
+func (postgresDialect) like() string {
+	return "ILIKE"
+}
+
+func (postgresDialect) upsert(table string, key string, columns ...string) string {
+	var assignments []string
+	for _, column := range columns {
+		if column != key {
+			assignments = append(assignments, column+" = EXCLUDED."+column)
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s", table,
+		strings.Join(columns, ", "), placeholders(len(columns)), key, strings.Join(assignments, ", "))
+}
+
+func (postgresDialect) tableExists() string {
+	return `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`
+}
+
+func (postgresDialect) columnExists() string {
+	return `SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`
+}
+
+func (postgresDialect) searchSupported(db queryRower) (bool, error) {
+	// the search index is built with FTS5 of SQLite
+	return false, nil
+}
+
+func (postgresDialect) isConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (postgresDialect) scripts() schemaScripts {
+	return schemaScripts{
+		baselineVersion: postgresBaselineVersion,
+		baseline:        []string{"sql/postgres/create-schema.sql"},
+		migrationsDir:   "sql/postgres/migrations",
+		drop:            "sql/postgres/drop.sql",
+		versionTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied TIMESTAMPTZ
+		)`,
+	}
+}
+
+// placeholders returns n comma separated placeholders.
+func placeholders(n int) string {
+	return "?" + strings.Repeat(", ?", n-1)
+}
+
+// database passes the queries through the rebind of its dialect.
+type database struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (db *database) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.dialect.rebind(query), args...)
+}
+
+func (db *database) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.dialect.rebind(query), args...)
+}
+
+func (db *database) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.dialect.rebind(query), args...)
+}
+
+func (db *database) Begin() (*transaction, error) {
+	tx, err := db.DB.Begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &transaction{Tx: tx, dialect: db.dialect}, nil
+}
+
+// transaction passes the queries through the rebind of its dialect.
+type transaction struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (tx *transaction) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.dialect.rebind(query), args...)
+}
+
+func (tx *transaction) QueryRow(query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.dialect.rebind(query), args...)
+}
+
+func (tx *transaction) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.dialect.rebind(query), args...)
+}
+
+func (tx *transaction) Prepare(query string) (*sql.Stmt, error) {
+	return tx.Tx.Prepare(tx.dialect.rebind(query))
+}
@@ -0,0 +1,86 @@
+package wasgeit
+
+import (
+	"sort"
+	"time"
+)
+
+// duplicateStartWindow is how far apart the start times of duplicates without end time may be.
+const duplicateStartWindow = 3 * time.Hour
+
+// FindDuplicates clusters events listed by several venues: events at the same location with the same normalized title
+// taking place at overlapping times. Each cluster holds events of different venues, ordered by ID, so the first event
+// of a cluster is the one stored first. Events without duplicates are left out.
+func FindDuplicates(events []Event) [][]Event {
+	groups := make(map[string][]Event)
+
+	for _, ev := range events {
+		key := ev.Venue.LocationKey() + "|" + Normalize(ev.Title)
+		groups[key] = append(groups[key], ev)
+	}
+
+	var clusters [][]Event
+
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool { return group[i].DateTime.Before(group[j].DateTime) })
+
+		var open [][]Event
+		for _, ev := range group {
+			joined := false
+			for i, cluster := range open {
+				if canJoin(cluster, ev) {
+					open[i] = append(cluster, ev)
+					joined = true
+					break
+				}
+			}
+			if !joined {
+				open = append(open, []Event{ev})
+			}
+		}
+
+		for _, cluster := range open {
+			if len(cluster) > 1 {
+				sort.Slice(cluster, func(i, j int) bool { return cluster[i].ID < cluster[j].ID })
+				clusters = append(clusters, cluster)
+			}
+		}
+	}
+
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i][0].ID < clusters[j][0].ID })
+
+	return clusters
+}
+
+// canJoin tells whether ev overlaps with the events of the cluster and none of them is listed by the same venue, two
+// shows of a single venue are not duplicates.
+func canJoin(cluster []Event, ev Event) bool {
+	for _, other := range cluster {
+		if other.Venue.ShortName == ev.Venue.ShortName || !overlap(other, ev) {
+			return false
+		}
+	}
+	return true
+}
+
+func overlap(ev1 Event, ev2 Event) bool {
+	if dayKey(ev1.DateTime) != dayKey(ev2.DateTime) {
+		return false
+	}
+
+	// some venues publish the date only
+	if isMidnight(ev1.DateTime) || isMidnight(ev2.DateTime) {
+		return true
+	}
+
+	if !ev1.EndDateTime.IsZero() && !ev2.EndDateTime.IsZero() {
+		return ev1.DateTime.Before(ev2.EndDateTime) && ev2.DateTime.Before(ev1.EndDateTime)
+	}
+
+	return absDuration(ev1.DateTime.Sub(ev2.DateTime)) <= duplicateStartWindow
+}
+
+func isMidnight(t time.Time) bool {
+	t = t.In(location)
+	return t.Hour() == 0 && t.Minute() == 0
+}
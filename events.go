@@ -1,17 +1,137 @@
 package wasgeit
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// EventStatus tells whether an event takes place as announced.
+type EventStatus string
+
+const (
+	StatusScheduled EventStatus = "scheduled"
+	StatusCancelled EventStatus = "cancelled"
+	StatusPostponed EventStatus = "postponed"
+	StatusSoldOut   EventStatus = "sold-out"
+)
+
+// OrScheduled returns the status, an unknown status means the event is scheduled.
+func (status EventStatus) OrScheduled() EventStatus {
+	if status == "" {
+		return StatusScheduled
+	}
+	return status
+}
+
 // Event describes an event taking place in a Venue
 type Event struct {
-	ID       int64
+	ID int64
+	// PublicID identifies the event towards clients, it is assigned on creation and never recomputed on updates, see
+	// PublicEventID
+	PublicID string
 	Title    string
 	DateTime time.Time
 	Created  time.Time
 	URL      string
 	Venue    Venue
+	Status   EventStatus
+	// The following fields are optional, most of them are only known for crawlers reading detail pages, see Details.
+	// Zero values denote unknown values.
+	Description string
+	Price       *PriceRange
+	Doors       time.Time
+	EndDateTime time.Time
+	Genres      []string
+	Support     []string
+	ImageURL    string
+	TicketURL   string
+	// MissingCrawls counts the consecutive crawls of the venue the event was missing from
+	MissingCrawls int
+	// Removed is set once the event vanished from the venue's listing, see TrackingOptions
+	Removed       time.Time
+	RemovalReason string
+	// CanonicalID links a duplicate listed by another venue to the canonical event, see FindDuplicates
+	CanonicalID int64
+	// SourceVenues are the venues of the duplicates of a canonical event
+	SourceVenues []Venue
+}
+
+// PublicEventID derives the public ID of a new event from its venue, the identity assigned by the crawler and its
+// start, e.g. "dachstock-3f2a9c1b0d4e". The start tells apart the dates of a show listed under a single URL. The ID is
+// derived once, when the event is created, and kept as it is when the event is rescheduled later on.
+func PublicEventID(venue string, identity string, start time.Time) string {
+	hash := sha1.Sum([]byte(venue + "\x00" + identity + "\x00" + start.UTC().Format(time.RFC3339)))
+	return venue + "-" + hex.EncodeToString(hash[:6])
+}
+
+// claimPublicID returns id, suffixed with a counter if it is claimed already, and claims it.
+func claimPublicID(id string, claimed map[string]bool) string {
+	unique := id
+	for n := 2; claimed[unique]; n++ {
+		unique = id + "-" + strconv.Itoa(n)
+	}
+	claimed[unique] = true
+	return unique
+}
+
+// Fields of an Event as named in Update.ChangedFields and in the updates log.
+const (
+	FieldTitle       = "title"
+	FieldDate        = "date"
+	FieldURL         = "url"
+	FieldStatus      = "status"
+	FieldDescription = "description"
+	FieldPrice       = "price"
+	FieldDoors       = "doors"
+	FieldEndDate     = "end_date"
+	FieldGenres      = "genres"
+	FieldSupport     = "support"
+	FieldImageURL    = "image_url"
+	FieldTicketURL   = "ticket_url"
+	// FieldRemoved is only used in the updates log, it records the removal reason
+	FieldRemoved = "removed"
+)
+
+// optionalFields are only compared if the crawler found a value, so a detail page which could not be read once does
+// not wipe what was read before.
+var optionalFields = []string{FieldDescription, FieldPrice, FieldDoors, FieldEndDate, FieldGenres, FieldSupport,
+	FieldImageURL, FieldTicketURL}
+
+// FieldValue returns the value of the given field, see the Field constants.
+func (ev Event) FieldValue(field string) interface{} {
+	switch field {
+	case FieldTitle:
+		return ev.Title
+	case FieldDate:
+		return ev.DateTime
+	case FieldURL:
+		return ev.URL
+	case FieldStatus:
+		return ev.Status.OrScheduled()
+	case FieldDescription:
+		return ev.Description
+	case FieldPrice:
+		return ev.Price
+	case FieldDoors:
+		return ev.Doors
+	case FieldEndDate:
+		return ev.EndDateTime
+	case FieldGenres:
+		return ev.Genres
+	case FieldSupport:
+		return ev.Support
+	case FieldImageURL:
+		return ev.ImageURL
+	case FieldTicketURL:
+		return ev.TicketURL
+	default:
+		panic(fmt.Sprintf("Unknown event field %q", field))
+	}
 }
 
 type Update struct {
@@ -20,50 +140,207 @@ type Update struct {
 	ChangedFields []string
 }
 
+// Values returns the old and the new value of a changed field.
+func (update Update) Values(field string) (oldValue interface{}, newValue interface{}) {
+	return update.ExistingEv.FieldValue(field), update.UpdatedEv.FieldValue(field)
+}
+
+// EventUpdate is an entry of the updates log, the values are stored as text.
+type EventUpdate struct {
+	ID       int64
+	DateTime time.Time
+	Field    string
+	Old      string
+	New      string
+	Event    Event
+}
+
+// UpdateFilter restricts the updates returned by Store.FindRecentUpdates.
+type UpdateFilter struct {
+	// Venues are short names, all venues are included if empty
+	Venues []string
+	// Fields restricts the updates to changes of the given fields, e.g. FieldDate
+	Fields []string
+	From   time.Time
+	// To is exclusive, there is no upper bound if zero
+	To    time.Time
+	Limit int
+}
+
 type ChangeSet struct {
 	New     []Event
 	Updates []Update
+	// Missing are events not found by the crawl, with MissingCrawls already incremented
+	Missing []Event
+	// Removed are events missing for TrackingOptions.RemovalGrace crawls, with RemovalReason set
+	Removed []Event
+	// Reappeared are events found again after being missing or removed
+	Reappeared []Event
 }
 
-// TODO query DB directly instead of loading all events?
-func DedupeAndTrackChanges(existingEvents []Event, newEvents []Event, cr Crawler) ChangeSet {
+// TrackingOptions control how DedupeAndTrackChanges matches events and treats events missing from a crawl.
+type TrackingOptions struct {
+	// Now separates past events, which are expected to vanish from the listings, from future ones
+	Now time.Time
+	// RemovalGrace is the number of consecutive crawls a future event may be missing before it is removed, 0 disables
+	// the tracking of missing events
+	RemovalGrace int
+	// FuzzyThreshold is the similarity of the normalized titles needed to match events whose identity differs,
+	// defaults to 0.8. A negative threshold disables fuzzy matching.
+	FuzzyThreshold float64
+	// FuzzyWindow is how far apart the dates of fuzzily matched events may be, defaults to a day
+	FuzzyWindow time.Duration
+}
+
+// DedupeAndTrackChanges matches the events of a crawl with the events of the venue stored before. Events are matched
+// by the identity the crawler assigns them. Events left over are matched by title similarity within a date window,
+// so a changed URL or a fixed typo is recorded as an update rather than a new event.
+func DedupeAndTrackChanges(existingEvents []Event, newEvents []Event, cr Crawler, opts TrackingOptions) ChangeSet {
 	var cs ChangeSet
-	uniquenessVotes := 0
+	var unmatched []Event
+
+	index := newEventIndex(existingEvents, cr, opts)
+
+	claimedIDs := make(map[string]bool)
+	for _, existingEv := range existingEvents {
+		claimedIDs[existingEv.PublicID] = true
+	}
 
 	for _, newEv := range newEvents {
-		for _, existingEv := range existingEvents {
-			if cr.IsSame(newEv, existingEv) {
-				if hasDiff, update := diff(newEv, existingEv); hasDiff {
-					cs.Updates = append(cs.Updates, update)
-				}
-			} else {
-				uniquenessVotes++
+		if i, found := index.claimByIdentity(newEv); found {
+			if hasDiff, update := diff(newEv, existingEvents[i]); hasDiff {
+				cs.Updates = append(cs.Updates, update)
 			}
+		} else {
+			unmatched = append(unmatched, newEv)
 		}
-		if uniquenessVotes == len(existingEvents) {
+	}
+
+	// fuzzy matching comes second, so it cannot take an event away from its exact match
+	for _, newEv := range unmatched {
+		if i, found := index.claimBySimilarity(newEv); found {
+			if hasDiff, update := diff(newEv, existingEvents[i]); hasDiff {
+				cs.Updates = append(cs.Updates, update)
+			}
+		} else {
+			newEv.PublicID = claimPublicID(PublicEventID(newEv.Venue.ShortName, cr.Identity(newEv), newEv.DateTime), claimedIDs)
 			cs.New = append(cs.New, newEv)
 		}
-		uniquenessVotes = 0
 	}
 
+	trackMissing(&cs, existingEvents, index.claimed, latest(newEvents), opts)
+
 	return cs
 }
 
-func diff(newEv Event, existingEv Event) (bool, Update) {
-	sameTitle := newEv.Title == existingEv.Title
-	sameTime := newEv.DateTime.Equal(existingEv.DateTime)
+// trackMissing fills the missing, removed and reappeared events of the change set. Events after the last event
+// found are left alone, they may just lie beyond what the listing shows.
+func trackMissing(cs *ChangeSet, existingEvents []Event, seen []bool, lastFound time.Time, opts TrackingOptions) {
+	if opts.RemovalGrace <= 0 {
+		return
+	}
+
+	for i, existingEv := range existingEvents {
+		if seen[i] {
+			if existingEv.MissingCrawls > 0 || !existingEv.Removed.IsZero() {
+				cs.Reappeared = append(cs.Reappeared, existingEv)
+			}
+			continue
+		}
+
+		if !existingEv.Removed.IsZero() || !existingEv.DateTime.After(opts.Now) || existingEv.DateTime.After(lastFound) {
+			continue
+		}
+
+		existingEv.MissingCrawls++
 
-	if sameTitle && sameTime {
-		return false, Update{}
+		if existingEv.MissingCrawls >= opts.RemovalGrace {
+			existingEv.RemovalReason = fmt.Sprintf("missing from the listing for %d consecutive crawls", existingEv.MissingCrawls)
+			cs.Removed = append(cs.Removed, existingEv)
+		} else {
+			cs.Missing = append(cs.Missing, existingEv)
+		}
+	}
+}
+
+func latest(events []Event) time.Time {
+	var latest time.Time
+	for _, ev := range events {
+		if ev.DateTime.After(latest) {
+			latest = ev.DateTime
+		}
 	}
+	return latest
+}
 
+func diff(newEv Event, existingEv Event) (bool, Update) {
 	update := Update{ExistingEv: existingEv, UpdatedEv: newEv}
-	if !sameTime {
-		update.ChangedFields = append(update.ChangedFields, "date")
+
+	if !newEv.DateTime.Equal(existingEv.DateTime) {
+		update.ChangedFields = append(update.ChangedFields, FieldDate)
 	}
-	if !sameTitle {
-		update.ChangedFields = append(update.ChangedFields, "title")
+	if newEv.Title != existingEv.Title {
+		update.ChangedFields = append(update.ChangedFields, FieldTitle)
 	}
+	if newEv.URL != existingEv.URL {
+		update.ChangedFields = append(update.ChangedFields, FieldURL)
+	}
+	if newEv.Status.OrScheduled() != existingEv.Status.OrScheduled() {
+		update.ChangedFields = append(update.ChangedFields, FieldStatus)
+	}
+
+	for _, field := range optionalFields {
+		newValue, existingValue := newEv.FieldValue(field), existingEv.FieldValue(field)
 
-	return true, update
+		if !isUnknown(newValue) && !sameValue(newValue, existingValue) {
+			update.ChangedFields = append(update.ChangedFields, field)
+		}
+	}
+
+	return len(update.ChangedFields) > 0, update
+}
+
+func isUnknown(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v == ""
+	case time.Time:
+		return v.IsZero()
+	case []string:
+		return len(v) == 0
+	case *PriceRange:
+		return v == nil
+	default:
+		return value == nil
+	}
+}
+
+func sameValue(v1 interface{}, v2 interface{}) bool {
+	if t1, ok := v1.(time.Time); ok {
+		t2, _ := v2.(time.Time)
+		return t1.Equal(t2)
+	}
+	return reflect.DeepEqual(v1, v2)
+}
+
+// formatFieldValue renders a field value the way it is written to the updates log.
+func formatFieldValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *PriceRange:
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	case []string:
+		return strings.Join(v, ", ")
+	case EventStatus:
+		return string(v)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(loggedTimeLayout)
+	default:
+		return value
+	}
 }
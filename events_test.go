@@ -0,0 +1,174 @@
+package wasgeit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDedupeTracksMissingEvents(t *testing.T) {
+	cr := &HTMLCrawler{config: HTMLConfig{Identity: urlIdentity}}
+	opts := TrackingOptions{Now: fixtureTime, RemovalGrace: 2}
+	day := 24 * time.Hour
+
+	past := Event{ID: 1, URL: "/past", DateTime: fixtureTime.Add(-day)}
+	kept := Event{ID: 2, URL: "/kept", DateTime: fixtureTime.Add(day)}
+	missing := Event{ID: 3, URL: "/missing", DateTime: fixtureTime.Add(2 * day)}
+	removed := Event{ID: 4, URL: "/removed", DateTime: fixtureTime.Add(3 * day), MissingCrawls: 1}
+	beyond := Event{ID: 5, URL: "/beyond", DateTime: fixtureTime.Add(30 * day)}
+	back := Event{ID: 6, URL: "/back", DateTime: fixtureTime.Add(day), MissingCrawls: 2, Removed: fixtureTime}
+	last := Event{URL: "/last", DateTime: fixtureTime.Add(10 * day)}
+
+	existing := []Event{past, kept, missing, removed, beyond, back}
+	cs := DedupeAndTrackChanges(existing, []Event{kept, back, last}, cr, opts)
+
+	if len(cs.New) != 1 || cs.New[0].URL != last.URL {
+		t.Errorf("expected %q to be new, got %v", last.URL, cs.New)
+	}
+
+	if len(cs.Missing) != 1 || cs.Missing[0].ID != missing.ID || cs.Missing[0].MissingCrawls != 1 {
+		t.Errorf("expected event %d to be missing once, got %v", missing.ID, cs.Missing)
+	}
+
+	if len(cs.Removed) != 1 || cs.Removed[0].ID != removed.ID || cs.Removed[0].RemovalReason == "" {
+		t.Errorf("expected event %d to be removed, got %v", removed.ID, cs.Removed)
+	}
+
+	if len(cs.Reappeared) != 1 || cs.Reappeared[0].ID != back.ID {
+		t.Errorf("expected event %d to reappear, got %v", back.ID, cs.Reappeared)
+	}
+
+	if cs := DedupeAndTrackChanges(existing, []Event{kept, last}, cr, TrackingOptions{Now: fixtureTime}); len(cs.Missing)+len(cs.Removed) != 0 {
+		t.Errorf("expected missing events to be ignored without grace, got %v", cs)
+	}
+}
+
+func TestDedupeMatchesFuzzily(t *testing.T) {
+	cr := &HTMLCrawler{config: HTMLConfig{Identity: urlIdentity}}
+	opts := TrackingOptions{Now: fixtureTime}
+	evening := time.Date(2019, time.June, 20, 20, 0, 0, 0, location)
+
+	existing := []Event{
+		{ID: 1, Title: "Patent Ochsner", URL: "/events/patent-ochsner", DateTime: evening},
+		{ID: 2, Title: "Stephan Eicher", URL: "/events/2", DateTime: evening.Add(24 * time.Hour)},
+		{ID: 3, Title: "Züri West", URL: "/events/3", DateTime: evening.Add(48 * time.Hour)},
+	}
+
+	crawled := []Event{
+		// slug changed
+		{Title: "Patent Ochsner", URL: "/events/patent-ochsner-2019", DateTime: evening},
+		// typo fixed
+		{Title: "Stephan Eicher!", URL: "/events/2", DateTime: evening.Add(24 * time.Hour)},
+		{Title: "Stefan Eicher", URL: "/events/2b", DateTime: evening.Add(24 * time.Hour)},
+		// umlaut spelled out
+		{Title: "Zueri West", URL: "/events/zueri-west", DateTime: evening.Add(48 * time.Hour)},
+		// same day, different show
+		{Title: "Sophie Hunger", URL: "/events/4", DateTime: evening},
+	}
+
+	cs := DedupeAndTrackChanges(existing, crawled, cr, opts)
+
+	if len(cs.New) != 2 || cs.New[0].Title != "Stefan Eicher" || cs.New[1].Title != "Sophie Hunger" {
+		t.Errorf("unexpected new events %v", cs.New)
+	}
+
+	expected := map[int64][]string{1: {FieldURL}, 2: {FieldTitle}, 3: {FieldTitle, FieldURL}}
+
+	if len(cs.Updates) != len(expected) {
+		t.Fatalf("expected %d updates, got %v", len(expected), cs.Updates)
+	}
+
+	for _, update := range cs.Updates {
+		if !reflect.DeepEqual(expected[update.ExistingEv.ID], update.ChangedFields) {
+			t.Errorf("expected event %d to change in %v, got %v", update.ExistingEv.ID, expected[update.ExistingEv.ID], update.ChangedFields)
+		}
+	}
+}
+
+func TestDedupeAssignsUniquePublicIDs(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+
+	cr := &HTMLCrawler{config: HTMLConfig{Identity: urlIdentity}}
+	venue := testVenue(t, st, "dampfzentrale")
+	evening := time.Date(2019, time.June, 20, 20, 0, 0, 0, location)
+
+	// a show played on two dates and listed twice under one URL
+	crawled := []Event{
+		{Title: "Tanzfest", URL: "/tanzfest", DateTime: evening, Venue: venue},
+		{Title: "Tanzfest", URL: "/tanzfest", DateTime: evening.Add(24 * time.Hour), Venue: venue},
+	}
+
+	cs := DedupeAndTrackChanges(nil, crawled, cr, TrackingOptions{Now: fixtureTime})
+
+	if len(cs.New) != 2 || cs.New[0].PublicID == cs.New[1].PublicID {
+		t.Fatalf("expected distinct public IDs, got %v", cs.New)
+	}
+
+	for _, ev := range cs.New {
+		if err := st.SaveEvent(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if events := testEvents(t, st, "dampfzentrale"); len(events) != 2 {
+		t.Errorf("expected both dates to be stored, got %d events", len(events))
+	}
+}
+
+func TestPublicIDSurvivesReschedule(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+
+	cr := &HTMLCrawler{config: HTMLConfig{Identity: urlIdentity}}
+	venue := testVenue(t, st, "kairo")
+	evening := time.Date(2019, time.June, 20, 20, 0, 0, 0, location)
+
+	cs := DedupeAndTrackChanges(nil, []Event{{Title: "Band", URL: "/band", DateTime: evening, Venue: venue}}, cr, TrackingOptions{Now: fixtureTime})
+
+	if err := st.SaveEvent(cs.New[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	existing := testEvents(t, st, "kairo")
+	publicID := existing[0].PublicID
+	rescheduled := evening.Add(7 * 24 * time.Hour)
+
+	cs = DedupeAndTrackChanges(existing, []Event{{Title: "Band", URL: "/band", DateTime: rescheduled, Venue: venue}}, cr, TrackingOptions{Now: fixtureTime})
+
+	if len(cs.New) != 0 || len(cs.Updates) != 1 {
+		t.Fatalf("expected the reschedule to be an update, got %+v", cs)
+	}
+
+	for _, field := range cs.Updates[0].ChangedFields {
+		_, newValue := cs.Updates[0].Values(field)
+		if err := st.UpdateEvent(cs.Updates[0].ExistingEv.ID, field, newValue); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := st.FindEvent(publicID)
+
+	if err != nil || !found.DateTime.Equal(rescheduled) {
+		t.Errorf("expected the rescheduled event under its original public ID, got %+v (%v)", found, err)
+	}
+
+	if publicID == PublicEventID("kairo", "/band", rescheduled) {
+		t.Errorf("expected the public ID to be derived from the original date only")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"Bierhübeli":               "bierhuebeli",
+		"  Café  Révolution!! ":    "cafe revolution",
+		"Mühle Hunziken – Live":    "muehle hunziken live",
+		"L'Orchestre de l'Été (F)": "l orchestre de l ete f",
+	}
+
+	for s, expected := range tests {
+		if actual := Normalize(s); actual != expected {
+			t.Errorf("expected %q to be normalized to %q, got %q", s, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package wasgeit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewsItem is an entry of the news feeds, either a newly announced or a rescheduled event.
+type NewsItem struct {
+	// ID is a tag URI which never changes for an item
+	ID        string
+	Title     string
+	Link      string
+	Summary   string
+	Published time.Time
+}
+
+// FeedInfo describes a news feed.
+type FeedInfo struct {
+	ID          string
+	Title       string
+	Description string
+	// Link points to the site, SelfLink to the feed itself
+	Link     string
+	SelfLink string
+}
+
+const (
+	newsTagPrefix    = "tag:wasgeit,2019:"
+	newsDateFormat   = "02.01.2006 15:04"
+	newsRescheduled  = "Rescheduled: "
+	rssContentType   = "application/rss+xml;charset=utf-8"
+	atomContentType  = "application/atom+xml;charset=utf-8"
+	atomNamespace    = "http://www.w3.org/2005/Atom"
+	rssVersion       = "2.0"
+	newsFeedLanguage = "de-ch"
+)
+
+// NewsItems merges newly announced events and date changes into a feed, latest first.
+func NewsItems(added []Event, rescheduled []EventUpdate) []NewsItem {
+	var items []NewsItem
+
+	for _, ev := range added {
+		items = append(items, NewsItem{
+			ID:        newsTagPrefix + "event/" + ev.PublicID,
+			Title:     ev.Title,
+			Link:      ev.URL,
+			Summary:   venueNames(ev) + ", " + ev.DateTime.In(location).Format(newsDateFormat),
+			Published: ev.Created,
+		})
+	}
+
+	for _, update := range rescheduled {
+		ev := update.Event
+		summary := venueNames(ev) + ", moved "
+
+		if old, err := ParseLoggedTime(update.Old); err == nil {
+			summary += "from " + old.In(location).Format(newsDateFormat) + " "
+		}
+
+		if moved, err := ParseLoggedTime(update.New); err == nil {
+			summary += "to " + moved.In(location).Format(newsDateFormat)
+		} else {
+			summary += "to " + ev.DateTime.In(location).Format(newsDateFormat)
+		}
+
+		items = append(items, NewsItem{
+			ID:        fmt.Sprintf("%supdate/%d", newsTagPrefix, update.ID),
+			Title:     newsRescheduled + ev.Title,
+			Link:      ev.URL,
+			Summary:   summary,
+			Published: update.DateTime,
+		})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Published.After(items[j].Published) })
+
+	return items
+}
+
+func venueNames(ev Event) string {
+	names := []string{ev.Venue.Name}
+	for _, v := range ev.SourceVenues {
+		names = append(names, v.Name)
+	}
+	return strings.Join(names, " / ")
+}
+
+// lastPublished returns the time the latest item was published, zero if there are none.
+func lastPublished(items []NewsItem) time.Time {
+	var last time.Time
+	for _, item := range items {
+		if item.Published.After(last) {
+			last = item.Published
+		}
+	}
+	return last
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	SelfLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// WriteRSS writes the items as RSS 2.0 feed.
+func WriteRSS(w io.Writer, info FeedInfo, items []NewsItem) error {
+	feed := rssFeed{
+		Version: rssVersion,
+		AtomNS:  atomNamespace,
+		Channel: rssChannel{
+			Title:       info.Title,
+			Link:        info.Link,
+			Description: info.Description,
+			Language:    newsFeedLanguage,
+			SelfLink:    atomLink{Href: info.SelfLink, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+
+	if last := lastPublished(items); !last.IsZero() {
+		feed.Channel.LastBuildDate = last.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, item := range items {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Summary,
+			GUID:        rssGUID{Value: item.ID},
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	return writeXML(w, feed)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary"`
+}
+
+// WriteAtom writes the items as Atom (RFC 4287) feed, which is updated when the latest item was published.
+func WriteAtom(w io.Writer, info FeedInfo, items []NewsItem, now time.Time) error {
+	updated := lastPublished(items)
+	if updated.IsZero() {
+		updated = now
+	}
+
+	feed := atomFeed{
+		NS:      atomNamespace,
+		ID:      info.ID,
+		Title:   info.Title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: info.SelfLink, Rel: "self", Type: "application/atom+xml"},
+			{Href: info.Link, Rel: "alternate"},
+		},
+		Author: atomAuthor{Name: info.Title},
+	}
+
+	for _, item := range items {
+		entry := atomEntry{
+			ID:        item.ID,
+			Title:     item.Title,
+			Updated:   item.Published.UTC().Format(time.RFC3339),
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Summary:   item.Summary,
+		}
+
+		if item.Link != "" {
+			entry.Links = []atomLink{{Href: item.Link, Rel: "alternate"}}
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return writeXML(w, feed)
+}
+
+func writeXML(w io.Writer, feed interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	return encoder.Encode(feed)
+}
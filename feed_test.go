@@ -0,0 +1,60 @@
+package wasgeit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewsItems(t *testing.T) {
+	created := time.Date(2019, time.June, 8, 10, 0, 0, 0, time.UTC)
+	ev := Event{
+		PublicID: "kairo-1",
+		Title:    "Band",
+		URL:      "http://www.cafekairo.ch/1",
+		DateTime: time.Date(2019, time.June, 21, 20, 30, 0, 0, location),
+		Created:  created,
+		Venue:    Venue{Name: "Café Kairo"},
+	}
+	rescheduled := EventUpdate{
+		ID:       7,
+		DateTime: created.Add(24 * time.Hour),
+		Field:    FieldDate,
+		Old:      "2019-06-20T20:30:00+02:00",
+		New:      "2019-06-21T20:30:00+02:00",
+		Event:    ev,
+	}
+
+	items := NewsItems([]Event{ev}, []EventUpdate{rescheduled})
+
+	if len(items) != 2 || items[0].ID != "tag:wasgeit,2019:update/7" || items[1].ID != "tag:wasgeit,2019:event/kairo-1" {
+		t.Fatalf("expected the rescheduled item first, got %+v", items)
+	}
+
+	if items[0].Summary != "Café Kairo, moved from 20.06.2019 20:30 to 21.06.2019 20:30" {
+		t.Errorf("unexpected summary %q", items[0].Summary)
+	}
+
+	info := FeedInfo{ID: "tag:wasgeit,2019:news", Title: "wasgeit", Link: "http://example.org/", SelfLink: "http://example.org/news.rss"}
+
+	for name, write := range map[string]func(*bytes.Buffer) error{
+		"rss":  func(b *bytes.Buffer) error { return WriteRSS(b, info, items) },
+		"atom": func(b *bytes.Buffer) error { return WriteAtom(b, info, items, created) },
+	} {
+		var b bytes.Buffer
+
+		if err := write(&b); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := xml.Unmarshal(b.Bytes(), new(interface{})); err != nil {
+			t.Errorf("%s feed is not well-formed: %v", name, err)
+		}
+
+		if !strings.Contains(b.String(), "tag:wasgeit,2019:update/7") {
+			t.Errorf("%s feed misses the rescheduled item:\n%s", name, b.String())
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package wasgeit
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Fetcher retrieves the HTML of a page.
+type Fetcher interface {
+	Fetch(ctxt context.Context, url string) (string, error)
+}
+
+// Validators identify the version of a page fetched before, see conditionalFetcher.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+func (v Validators) IsZero() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// ErrNotModified is returned by a conditional fetch if the page did not change.
+var ErrNotModified = errors.New("not modified")
+
+// conditionalFetcher is implemented by fetchers able to ask whether a page changed since it was fetched, i.e. the
+// HTTPFetcher.
+type conditionalFetcher interface {
+	FetchIfModified(ctxt context.Context, url string, validators Validators) (string, Validators, error)
+}
+
+// FetchMode selects the Fetcher of a crawler.
+type FetchMode string
+
+const (
+	// FetchWithBrowser renders the page in the remote chromium, needed for sites building their agenda with JavaScript.
+	FetchWithBrowser FetchMode = "browser"
+	// FetchWithHTTP issues a plain HTTP request, sufficient for static sites.
+	FetchWithHTTP FetchMode = "http"
+)
+
+// Fetchers holds the available Fetcher for each FetchMode.
+type Fetchers map[FetchMode]Fetcher
+
+// waitingFetcher is implemented by fetchers able to wait for a page to be ready, i.e. the Browser.
+type waitingFetcher interface {
+	WithWait(wait WaitCondition) Fetcher
+}
+
+// For returns the Fetcher the crawler asks for, set up to honour the crawler's WaitCondition.
+func (fetchers Fetchers) For(cr Crawler) (Fetcher, error) {
+	return fetchers.forMode(cr.Name(), cr.FetchMode(), cr.WaitCondition())
+}
+
+// ForDetails returns the Fetcher for the detail pages of the crawler.
+func (fetchers Fetchers) ForDetails(cr DetailCrawler) (Fetcher, error) {
+	return fetchers.forMode(cr.Name(), cr.DetailFetchMode(), cr.DetailWaitCondition())
+}
+
+func (fetchers Fetchers) forMode(name string, mode FetchMode, wait WaitCondition) (Fetcher, error) {
+	fetcher, exists := fetchers[mode]
+
+	if !exists {
+		return nil, fmt.Errorf("no fetcher available for mode %q of crawler %q", mode, name)
+	}
+
+	if waiting, ok := fetcher.(waitingFetcher); ok {
+		return waiting.WithWait(wait), nil
+	}
+
+	return fetcher, nil
+}
+
+const (
+	defaultUserAgent = "Mozilla/5.0 (compatible; wasgeit; +https://github.com/bjorm/wasgeit)"
+	maxRedirects     = 10
+)
+
+// HTTPFetcher fetches pages with net/http. Compressed responses and non UTF-8 charsets are decoded.
+type HTTPFetcher struct {
+	Client    *http.Client
+	UserAgent string
+}
+
+func NewHTTPFetcher() *HTTPFetcher {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+
+	return &HTTPFetcher{Client: client, UserAgent: defaultUserAgent}
+}
+
+func (f *HTTPFetcher) Fetch(ctxt context.Context, url string) (string, error) {
+	body, _, err := f.FetchIfModified(ctxt, url, Validators{})
+	return body, err
+}
+
+// FetchIfModified fetches url unless it is still the version identified by validators, in which case ErrNotModified is
+// returned. The validators of the fetched version are returned along with its body.
+func (f *HTTPFetcher) FetchIfModified(ctxt context.Context, url string, validators Validators) (string, Validators, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+
+	if err != nil {
+		return "", Validators{}, err
+	}
+
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+
+	req = req.WithContext(ctxt)
+	req.Header.Set("User-Agent", f.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	// setting this header disables the transparent decompression of net/http, hence the gzip handling below
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := f.Client.Do(req)
+
+	if err != nil {
+		return "", Validators{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return "", validators, ErrNotModified
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", Validators{}, fmt.Errorf("fetching %q failed with status %q", url, resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(resp.Body)
+
+		if err != nil {
+			return "", Validators{}, err
+		}
+
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+
+	utf8Body, err := charset.NewReader(body, resp.Header.Get("Content-Type"))
+
+	if err != nil {
+		return "", Validators{}, fmt.Errorf("could not decode %q: %v", url, err)
+	}
+
+	bytes, err := ioutil.ReadAll(utf8Body)
+
+	if err != nil {
+		return "", Validators{}, err
+	}
+
+	latest := Validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+
+	return string(bytes), latest, nil
+}
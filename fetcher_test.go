@@ -0,0 +1,52 @@
+package wasgeit
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPFetcher(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/programm", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/programm", func(w http.ResponseWriter, r *http.Request) {
+		if ua := r.Header.Get("User-Agent"); ua != defaultUserAgent {
+			t.Errorf("unexpected user agent %q", ua)
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=ISO-8859-1")
+		w.Header().Set("Content-Encoding", "gzip")
+
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		// "Bierhübeli" in ISO-8859-1
+		gz.Write([]byte("<html><body><h1>Bierh\xfcbeli</h1></body></html>"))
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := NewHTTPFetcher()
+
+	body, err := fetcher.Fetch(context.Background(), server.URL+"/moved")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(body, "<h1>Bierhübeli</h1>") {
+		t.Errorf("body was not decoded properly: %q", body)
+	}
+
+	if _, err := fetcher.Fetch(context.Background(), server.URL+"/gone"); err == nil {
+		t.Error("expected an error for status 404")
+	}
+}
@@ -13,55 +13,96 @@ var (
 	location, _ = time.LoadLocation("Europe/Zurich")
 )
 
+// yearRolloverGrace is how long ago a date without year may lie before it is taken to be next year's. Agendas tend to
+// list events of the past days for a while.
+const yearRolloverGrace = 30 * 24 * time.Hour
+
 type HTMLConfig struct {
 	EventSelector     string
 	TitleSelector     string
-	GetDateTimeString func(*goquery.Selection) string
+	GetDateTimeString func(*goquery.Selection) (string, error)
 	TimeFormat        string
 	LinkBuilder       func(Venue, *goquery.Selection) string
-	IsSameEvent       func(ev1, ev2 Event) bool
+	Identity          func(ev Event) string
+	// FetchMode defaults to FetchWithBrowser
+	FetchMode FetchMode
+	// Wait tells the browser when the page is ready, by default it waits for EventSelector to be visible
+	Wait       WaitCondition
+	Pagination Pagination
+	Status     StatusConfig
+	// Details is optional, if set the detail page of every event is read as well
+	Details *Details
 }
 
 type HTMLCrawler struct {
 	venue  Venue
-	dom    *goquery.Document
+	pages  []*goquery.Document
 	config HTMLConfig
+	clock  Clock
 }
 
 func (cr *HTMLCrawler) Name() string {
 	return cr.venue.ShortName
 }
 
-func (cr *HTMLCrawler) URL() string {
-	return cr.venue.URL
+func (cr *HTMLCrawler) Identity(ev Event) string {
+	return cr.config.Identity(ev)
 }
 
-func (cr *HTMLCrawler) IsSame(ev1, ev2 Event) bool {
-	return cr.config.IsSameEvent(ev1, ev2)
+func (cr *HTMLCrawler) FetchMode() FetchMode {
+	if cr.config.FetchMode == "" {
+		return FetchWithBrowser
+	}
+	return cr.config.FetchMode
 }
 
-func (cr *HTMLCrawler) Read(body string) error {
-	dom, err := goquery.NewDocumentFromReader(strings.NewReader(body))
-	if err != nil {
-		return err
+func (cr *HTMLCrawler) WaitCondition() WaitCondition {
+	wait := cr.config.Wait
+	if wait.Visible == "" {
+		wait.Visible = cr.config.EventSelector
 	}
-	cr.dom = dom
+	return wait
+}
+
+// Read replaces the pages read before with the given ones.
+func (cr *HTMLCrawler) Read(bodies ...string) error {
+	var pages []*goquery.Document
+
+	for _, body := range bodies {
+		dom, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+		if err != nil {
+			return err
+		}
+		pages = append(pages, dom)
+	}
+
+	cr.pages = pages
 	return nil
 }
 
+// GetEvents returns the future events of all pages read. Events listed on several pages are returned once.
 func (cr *HTMLCrawler) GetEvents() ([]Event, []error) {
 	var evs []Event
 	var errors []error
-
-	cr.dom.Find(cr.config.EventSelector).Each(func(_ int, eventSelection *goquery.Selection) {
-		re := HTMLEvent{s: eventSelection, c: cr.config, v: cr.venue}
-		datetime, err := re.dateTime()
-		if err != nil {
-			errors = append(errors, err)
-		} else if datetime.After(time.Now()) {
-			evs = append(evs, Event{DateTime: datetime, Title: re.title(), URL: re.url(), Venue: cr.venue})
-		}
-	})
+	now := orSystemClock(cr.clock).Now()
+	seen := make(map[string]bool)
+
+	for _, dom := range cr.pages {
+		dom.Find(cr.config.EventSelector).Each(func(_ int, eventSelection *goquery.Selection) {
+			re := HTMLEvent{s: eventSelection, c: cr.config, v: cr.venue}
+			datetime, err := re.dateTime(now)
+			if err != nil {
+				errors = append(errors, err)
+			} else if datetime.After(now) {
+				status, title := cr.status(eventSelection, re.title())
+				ev := Event{DateTime: datetime, Title: title, URL: re.url(), Venue: cr.venue, Status: status}
+				if identity := cr.Identity(ev); !seen[identity] {
+					seen[identity] = true
+					evs = append(evs, ev)
+				}
+			}
+		})
+	}
 
 	return evs, errors
 }
@@ -81,8 +122,12 @@ func (e *HTMLEvent) url() string {
 	return e.c.LinkBuilder(e.v, e.s)
 }
 
-func (e *HTMLEvent) dateTime() (time.Time, error) {
-	timeStr := e.c.GetDateTimeString(e.s)
+func (e *HTMLEvent) dateTime(now time.Time) (time.Time, error) {
+	timeStr, err := e.c.GetDateTimeString(e.s)
+
+	if err != nil {
+		return time.Time{}, err
+	}
 
 	if timeStr == "" {
 		return time.Time{}, fmt.Errorf("Time selector yielded empty string")
@@ -95,18 +140,31 @@ func (e *HTMLEvent) dateTime() (time.Time, error) {
 		return time.Time{}, timeParseError
 	}
 
-	// TODO maybe move this into post-process method
-	// Some sites publish their events without specifying a year, we assume they take place this year.
+	// Some sites publish their events without specifying a year
 	if eventTime.Year() == 0 {
-		eventTime = eventTime.AddDate(time.Now().Year(), 0, 0)
+		eventTime = inferYear(eventTime, now)
 	}
 
 	return eventTime, nil
 }
 
-func returnStringSlice(start int, end int) func(string) string {
-	return func(toSlice string) string {
-		return toSlice[start:end]
+// inferYear moves a date without year to its nearest occurrence that lies no more than yearRolloverGrace before now.
+// This way a "02.01" seen in December is taken to be in January of the following year. Years the date does not exist
+// in are skipped, so a "29.02" is put in the next leap year instead of on the 1st of March.
+func inferYear(eventTime time.Time, now time.Time) time.Time {
+	earliest := now.Add(-yearRolloverGrace)
+
+	for year := now.Year() - 1; ; year++ {
+		candidate := time.Date(year, eventTime.Month(), eventTime.Day(), eventTime.Hour(), eventTime.Minute(),
+			eventTime.Second(), eventTime.Nanosecond(), eventTime.Location())
+
+		if candidate.Month() != eventTime.Month() || candidate.Day() != eventTime.Day() {
+			continue
+		}
+
+		if !candidate.Before(earliest) {
+			return candidate
+		}
 	}
 }
 
@@ -132,10 +190,10 @@ func StripSomeWhiteSpaces(toStrip string) string {
 	return wrp.Replace(toStrip)
 }
 
-func hasSameUrl(ev1, ev2 Event) bool {
-	return ev1.URL == ev2.URL
+func urlIdentity(ev Event) string {
+	return ev.URL
 }
 
-func hasSameTitleAndDate(ev1, ev2 Event) bool {
-	return ev1.Title == ev2.Title && ev1.DateTime.Equal(ev2.DateTime)
+func titleAndDateIdentity(ev Event) string {
+	return ev.Title + "@" + ev.DateTime.UTC().Format(time.RFC3339)
 }
@@ -0,0 +1,66 @@
+package wasgeit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInferYear(t *testing.T) {
+	tests := []struct {
+		now      time.Time
+		parsed   time.Time
+		expected time.Time
+	}{
+		{
+			now:      time.Date(2019, time.June, 10, 12, 0, 0, 0, location),
+			parsed:   time.Date(0, time.August, 3, 20, 0, 0, 0, location),
+			expected: time.Date(2019, time.August, 3, 20, 0, 0, 0, location),
+		},
+		{
+			now:      time.Date(2019, time.December, 20, 12, 0, 0, 0, location),
+			parsed:   time.Date(0, time.January, 2, 20, 0, 0, 0, location),
+			expected: time.Date(2020, time.January, 2, 20, 0, 0, 0, location),
+		},
+		{
+			now:      time.Date(2020, time.January, 3, 12, 0, 0, 0, location),
+			parsed:   time.Date(0, time.December, 28, 21, 0, 0, 0, location),
+			expected: time.Date(2019, time.December, 28, 21, 0, 0, 0, location),
+		},
+		{
+			now:      time.Date(2019, time.June, 10, 12, 0, 0, 0, location),
+			parsed:   time.Date(0, time.June, 8, 22, 0, 0, 0, location),
+			expected: time.Date(2019, time.June, 8, 22, 0, 0, 0, location),
+		},
+		{
+			now:      time.Date(2019, time.December, 31, 23, 0, 0, 0, location),
+			parsed:   time.Date(0, time.January, 1, 0, 30, 0, 0, location),
+			expected: time.Date(2020, time.January, 1, 0, 30, 0, 0, location),
+		},
+		{
+			now:      time.Date(2020, time.February, 10, 12, 0, 0, 0, location),
+			parsed:   time.Date(0, time.February, 29, 20, 0, 0, 0, location),
+			expected: time.Date(2020, time.February, 29, 20, 0, 0, 0, location),
+		},
+		{
+			now:      time.Date(2019, time.February, 10, 12, 0, 0, 0, location),
+			parsed:   time.Date(0, time.February, 29, 20, 0, 0, 0, location),
+			expected: time.Date(2020, time.February, 29, 20, 0, 0, 0, location),
+		},
+		{
+			now:      time.Date(2020, time.March, 15, 12, 0, 0, 0, location),
+			parsed:   time.Date(0, time.February, 29, 20, 0, 0, 0, location),
+			expected: time.Date(2020, time.February, 29, 20, 0, 0, 0, location),
+		},
+		{
+			now:      time.Date(2020, time.December, 20, 12, 0, 0, 0, location),
+			parsed:   time.Date(0, time.February, 29, 20, 0, 0, 0, location),
+			expected: time.Date(2024, time.February, 29, 20, 0, 0, 0, location),
+		},
+	}
+
+	for _, test := range tests {
+		if actual := inferYear(test.parsed, test.now); !actual.Equal(test.expected) {
+			t.Errorf("inferYear(%v, %v) = %v, expected %v", test.parsed, test.now, actual, test.expected)
+		}
+	}
+}
@@ -1,50 +1,161 @@
 package wasgeit
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	log "github.com/sirupsen/logrus"
+	"io"
 	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Server struct {
-	store *Store
+	store Storage
+	cache responseCache
 }
 
 type JsonEvent struct {
+	ID       string    `json:"id"`
 	Title    string    `json:"title"`
 	URL      string    `json:"url"`
 	DateTime time.Time `json:"datetime"`
 	Venue    Venue     `json:"venue"`
-	Created  time.Time `json:"created"`
+	// Venues lists all venues the event is listed by, starting with Venue
+	Venues      []Venue     `json:"venues"`
+	Created     time.Time   `json:"created"`
+	Status      EventStatus `json:"status"`
+	Description string      `json:"description,omitempty"`
+	Price       *PriceRange `json:"price,omitempty"`
+	Doors       *time.Time  `json:"doors,omitempty"`
+	EndDateTime *time.Time  `json:"end_datetime,omitempty"`
+	Genres      []string    `json:"genres,omitempty"`
+	Support     []string    `json:"support,omitempty"`
+	ImageURL    string      `json:"image_url,omitempty"`
+	TicketURL   string      `json:"ticket_url,omitempty"`
 }
 
 func from(ev Event) JsonEvent {
-	return JsonEvent{Title: ev.Title, URL: ev.URL, DateTime: ev.DateTime, Venue: ev.Venue, Created: ev.Created}
+	return JsonEvent{
+		ID:          ev.PublicID,
+		Title:       ev.Title,
+		URL:         ev.URL,
+		DateTime:    ev.DateTime,
+		Venue:       ev.Venue,
+		Venues:      append([]Venue{ev.Venue}, ev.SourceVenues...),
+		Created:     ev.Created,
+		Status:      ev.Status.OrScheduled(),
+		Description: ev.Description,
+		Price:       ev.Price,
+		Doors:       optionalTime(ev.Doors),
+		EndDateTime: optionalTime(ev.EndDateTime),
+		Genres:      ev.Genres,
+		Support:     ev.Support,
+		ImageURL:    ev.ImageURL,
+		TicketURL:   ev.TicketURL,
+	}
+}
+
+// optionalTime is needed as omitempty does not apply to structs such as time.Time.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
 }
 
+// ServeAgenda serves the upcoming events grouped by date. They may be selected by the query parameters from and to
+// (RFC 3339 or dates, to is inclusive for dates), venue (may be repeated or comma separated) and q (free text), and
+// ordered by sort (date, -date, created or -created). If limit is given, the Link header points to the next page.
 func (server *Server) ServeAgenda(w http.ResponseWriter, r *http.Request) {
-	events := server.store.GetEventsYetToHappen()
+	query, err := server.parseAgendaQuery(r.URL.Query())
+
+	if err != nil {
+		server.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := server.store.FindAgenda(query)
+
+	if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the agenda failed")
+		return
+	}
+
+	if page.NextCursor != "" {
+		next := *r.URL
+		values := next.Query()
+		values.Set("cursor", page.NextCursor)
+		next.RawQuery = values.Encode()
+		w.Header().Add("Link", "<"+next.RequestURI()+`>; rel="next"`)
+	}
+
 	agenda := make(map[string][]interface{})
 
-	for _, ev := range events {
+	for _, ev := range page.Events {
 		date := ev.DateTime.Format("2006-01-02")
 		agenda[date] = append(agenda[date], from(ev))
 	}
-	b, err := json.Marshal(agenda)
 
-	if err != nil {
-		panic(err)
+	server.writeJSON(w, agenda)
+}
+
+func (server *Server) parseAgendaQuery(values url.Values) (AgendaQuery, error) {
+	query := AgendaQuery{Text: values.Get("q"), Cursor: values.Get("cursor"), Sort: AgendaSort(values.Get("sort"))}
+	var err error
+
+	if from := values.Get("from"); from != "" {
+		if query.From, err = parseTimeParameter(from); err != nil {
+			return query, fmt.Errorf("invalid from: %s", err)
+		}
 	}
 
-	server.setContentType(w.Header())
-	server.setEtag(w.Header())
+	if to := values.Get("to"); to != "" {
+		if query.To, err = parseTimeParameter(to); err != nil {
+			return query, fmt.Errorf("invalid to: %s", err)
+		}
 
-	w.Write(b)
+		if isDate(to) {
+			query.To = query.To.AddDate(0, 0, 1)
+		}
+	}
+
+	for _, venues := range values["venue"] {
+		for _, venue := range strings.Split(venues, ",") {
+			if venue = strings.TrimSpace(venue); venue == "" {
+				continue
+			}
+
+			if _, err := server.store.FindVenue(venue); err != nil {
+				return query, fmt.Errorf("unknown venue %q", venue)
+			}
+			query.Venues = append(query.Venues, venue)
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 {
+			return query, fmt.Errorf("limit has to be between 1 and %d", MaxAgendaLimit)
+		}
+	}
+
+	return query, query.Validate()
 }
 
 func (server *Server) ServeNews(w http.ResponseWriter, r *http.Request) {
-	events := server.store.GetEventsAddedDuringLastWeek()
+	events, err := server.store.GetEventsAddedDuringLastWeek()
+
+	if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the news failed")
+		return
+	}
+
 	news := make(map[string][]interface{})
 
 	for _, ev := range events {
@@ -52,16 +163,87 @@ func (server *Server) ServeNews(w http.ResponseWriter, r *http.Request) {
 		news[date] = append(news[date], from(ev))
 	}
 
-	b, err := json.Marshal(news)
+	server.writeJSON(w, news)
+}
+
+// newsFeedInfo describes the news feeds, linking to the host the request was sent to.
+func newsFeedInfo(r *http.Request) FeedInfo {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	site := scheme + "://" + r.Host
+
+	return FeedInfo{
+		ID:          newsTagPrefix + "news",
+		Title:       "wasgeit",
+		Description: "Newly announced and rescheduled shows in Bern",
+		Link:        site + "/",
+		SelfLink:    site + r.URL.Path,
+	}
+}
+
+// newsItems reads the events added during the last week along with the events rescheduled during that time.
+func (server *Server) newsItems() ([]NewsItem, error) {
+	added, err := server.store.GetEventsAddedDuringLastWeek()
 
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	server.setContentType(w.Header())
-	server.setEtag(w.Header())
+	rescheduled, err := server.store.FindRecentUpdates(UpdateFilter{
+		From:   server.store.Now().Add(-defaultUpdatesPeriod),
+		Fields: []string{FieldDate},
+	})
 
-	w.Write(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewsItems(added, rescheduled), nil
+}
+
+// ServeNewsRSS serves the news as RSS feed.
+func (server *Server) ServeNewsRSS(w http.ResponseWriter, r *http.Request) {
+	server.serveNewsFeed(w, r, rssContentType, func(out io.Writer, items []NewsItem) error {
+		return WriteRSS(out, newsFeedInfo(r), items)
+	})
+}
+
+// ServeNewsAtom serves the news as Atom feed.
+func (server *Server) ServeNewsAtom(w http.ResponseWriter, r *http.Request) {
+	server.serveNewsFeed(w, r, atomContentType, func(out io.Writer, items []NewsItem) error {
+		return WriteAtom(out, newsFeedInfo(r), items, server.store.Now())
+	})
+}
+
+// serveNewsFeed writes a feed which was last modified when its latest item was published.
+func (server *Server) serveNewsFeed(w http.ResponseWriter, r *http.Request, contentType string, write func(io.Writer, []NewsItem) error) {
+	items, err := server.newsItems()
+
+	if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the news failed")
+		return
+	}
+
+	var b bytes.Buffer
+
+	if err := write(&b, items); err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "writing the feed failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Vary", "Host, X-Forwarded-Proto")
+
+	if last := lastPublished(items); !last.IsZero() {
+		w.Header().Set("Last-Modified", last.UTC().Format(http.TimeFormat))
+	}
+
+	w.Write(b.Bytes())
 }
 
 func (server *Server) ServeFestivals(w http.ResponseWriter, r *http.Request) {
@@ -69,28 +251,371 @@ func (server *Server) ServeFestivals(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the festivals failed")
+		return
+	}
+
+	server.writeJSON(w, festivals)
+}
+
+// JsonUpdate is an entry of the updates log, Event is left out in the history of a single event.
+type JsonUpdate struct {
+	DateTime time.Time  `json:"datetime"`
+	Field    string     `json:"field"`
+	Old      string     `json:"old"`
+	New      string     `json:"new"`
+	Event    *JsonEvent `json:"event,omitempty"`
+}
+
+func fromUpdate(update EventUpdate, withEvent bool) JsonUpdate {
+	jsonUpdate := JsonUpdate{DateTime: update.DateTime, Field: update.Field, Old: update.Old, New: update.New}
+
+	if withEvent {
+		ev := from(update.Event)
+		jsonUpdate.Event = &ev
+	}
+
+	return jsonUpdate
+}
+
+const (
+	defaultUpdatesPeriod = 7 * 24 * time.Hour
+	defaultUpdatesLimit  = 100
+	maxUpdatesLimit      = 1000
+)
+
+// JsonEventWithHistory is a single event along with its change history.
+type JsonEventWithHistory struct {
+	JsonEvent
+	Removed       *time.Time   `json:"removed,omitempty"`
+	RemovalReason string       `json:"removal_reason,omitempty"`
+	History       []JsonUpdate `json:"history"`
+}
+
+// ServeEvents serves the resources below /events/, that is /events/{id}, /events/{id}.ics and /events/{id}/history.
+func (server *Server) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/events/"), "/"), "/")
+
+	if parts[0] == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "history") {
+		server.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if len(parts) == 1 && strings.HasSuffix(parts[0], calendarExtension) {
+		server.serveEventCalendar(w, strings.TrimSuffix(parts[0], calendarExtension))
+		return
+	}
+
+	ev, updates, found := server.findEventWithHistory(w, parts[0])
+
+	if !found {
+		return
+	}
+
+	history := []JsonUpdate{}
+
+	for _, update := range updates {
+		history = append(history, fromUpdate(update, false))
+	}
+
+	if len(parts) == 2 {
+		server.writeJSON(w, struct {
+			Event   JsonEvent    `json:"event"`
+			Updates []JsonUpdate `json:"updates"`
+		}{Event: from(ev), Updates: history})
+		return
+	}
+
+	server.writeJSON(w, JsonEventWithHistory{
+		JsonEvent:     from(ev),
+		Removed:       optionalTime(ev.Removed),
+		RemovalReason: ev.RemovalReason,
+		History:       history,
+	})
+}
+
+// findEventWithHistory looks up an event and its updates, it answers the request unless both were found.
+func (server *Server) findEventWithHistory(w http.ResponseWriter, id string) (Event, []EventUpdate, bool) {
+	ev, err := server.store.FindEvent(id)
+
+	if err == ErrEventNotFound {
+		server.writeError(w, http.StatusNotFound, fmt.Sprintf("there is no event %q", id))
+		return Event{}, nil, false
+	} else if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the event failed")
+		return Event{}, nil, false
 	}
 
-	b, err := json.Marshal(festivals)
+	updates, err := server.store.FindEventUpdates(ev.ID)
 
 	if err != nil {
-		panic(err)
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the history failed")
+		return Event{}, nil, false
+	}
+
+	return ev, updates, true
+}
+
+const calendarExtension = ".ics"
+
+// ServeAgendaCalendar serves the upcoming events of all venues as iCalendar.
+func (server *Server) ServeAgendaCalendar(w http.ResponseWriter, r *http.Request) {
+	events, err := server.store.FindCalendarEvents("")
+
+	if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the agenda failed")
+		return
+	}
+
+	server.writeCalendar(w, "wasgeit", events)
+}
+
+// ServeVenues serves the resources below /venues/, that is /venues/{shortname}/events.ics.
+func (server *Server) ServeVenues(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/venues/"), "/"), "/")
+
+	if len(parts) != 2 || parts[1] != "events"+calendarExtension {
+		server.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	venue, err := server.store.FindVenue(parts[0])
+
+	if err != nil {
+		server.writeError(w, http.StatusNotFound, fmt.Sprintf("there is no venue %q", parts[0]))
+		return
+	}
+
+	events, err := server.store.FindCalendarEvents(venue.ShortName)
+
+	if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the events failed")
+		return
+	}
+
+	server.writeCalendar(w, venue.Name, events)
+}
+
+func (server *Server) serveEventCalendar(w http.ResponseWriter, id string) {
+	ev, err := server.store.FindEvent(id)
+
+	if err == ErrEventNotFound {
+		server.writeError(w, http.StatusNotFound, fmt.Sprintf("there is no event %q", id))
+		return
+	} else if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the event failed")
+		return
+	}
+
+	server.writeCalendar(w, ev.Title, []Event{ev})
+}
+
+func (server *Server) writeCalendar(w http.ResponseWriter, name string, events []Event) {
+	revisions, err := server.store.FindRevisions()
+
+	if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the revisions failed")
+		return
+	}
+
+	var b bytes.Buffer
+
+	if err := WriteCalendar(&b, name, events, revisions); err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "writing the calendar failed")
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/calendar;charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// JsonSearchResult is an event found by a search, see SearchResult.
+type JsonSearchResult struct {
+	JsonEvent
+	Snippet string `json:"snippet"`
+}
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// ServeSearch serves the upcoming events matching the query parameter q, the best matches first. The number of
+// results may be restricted by limit.
+func (server *Server) ServeSearch(w http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if text == "" {
+		server.writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	limit := defaultSearchLimit
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxSearchLimit {
+			server.writeError(w, http.StatusBadRequest, fmt.Sprintf("limit has to be between 1 and %d", maxSearchLimit))
+			return
+		}
+	}
+
+	results, err := server.store.Search(text, limit)
+
+	if err == ErrSearchUnavailable {
+		server.writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	} else if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "searching failed")
+		return
+	}
+
+	found := []JsonSearchResult{}
+
+	for _, result := range results {
+		found = append(found, JsonSearchResult{JsonEvent: from(result.Event), Snippet: result.Snippet})
+	}
+
+	server.writeJSON(w, found)
+}
+
+// ServeUpdates serves the recently changed events. The updates may be filtered by the query parameters venue (may be
+// repeated), from and to (RFC 3339 or dates), limit restricts their number.
+func (server *Server) ServeUpdates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := UpdateFilter{Venues: query["venue"], From: server.store.Now().Add(-defaultUpdatesPeriod), Limit: defaultUpdatesLimit}
+
+	var err error
+
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = parseTimeParameter(from); err != nil {
+			server.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid from: %s", err))
+			return
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = parseTimeParameter(to); err != nil {
+			server.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid to: %s", err))
+			return
+		}
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 1 || filter.Limit > maxUpdatesLimit {
+			server.writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxUpdatesLimit))
+			return
+		}
+	}
+
+	updates, err := server.store.FindRecentUpdates(filter)
+
+	if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "reading the updates failed")
+		return
+	}
+
+	feed := []JsonUpdate{}
+
+	for _, update := range updates {
+		feed = append(feed, fromUpdate(update, true))
+	}
+
+	server.writeJSON(w, feed)
+}
+
+const dateParameterFormat = "2006-01-02"
+
+// parseTimeParameter accepts RFC 3339 timestamps and dates, which refer to local midnight.
+func parseTimeParameter(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(dateParameterFormat, value, location); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func isDate(value string) bool {
+	_, err := time.Parse(dateParameterFormat, value)
+	return err == nil
+}
+
+func (server *Server) writeJSON(w http.ResponseWriter, value interface{}) {
+	b, err := json.Marshal(value)
+
+	if err != nil {
+		log.Error(err)
+		server.writeError(w, http.StatusInternalServerError, "encoding the response failed")
+		return
 	}
 
 	server.setContentType(w.Header())
+	w.Write(b)
+}
 
+// JsonError is the body of the responses to failed requests.
+type JsonError struct {
+	Error string `json:"error"`
+}
+
+// writeError answers with the given status and a JSON object holding the message.
+func (server *Server) writeError(w http.ResponseWriter, status int, message string) {
+	// encoding a string cannot fail
+	b, _ := json.Marshal(JsonError{Error: message})
+
+	server.setContentType(w.Header())
+	w.WriteHeader(status)
 	w.Write(b)
 }
 
-func (server *Server) setContentType(h http.Header) {
-	h.Add("Content-Type", "application/json;charset=utf-8")
+// recovered answers requests with a JSON error if the handler panics, instead of dropping the connection.
+func (server *Server) recovered(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				log.Errorf("Serving %s panicked: %v\n%s", r.URL, p, debug.Stack())
+				server.writeError(w, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+
+		handler.ServeHTTP(w, r)
+	})
 }
 
-func (server *Server) setEtag(h http.Header) {
-	h.Add("ETag", server.store.ReadValue(LastCrawlTimeKey))
+func (server *Server) setContentType(h http.Header) {
+	h.Add("Content-Type", "application/json;charset=utf-8")
 }
 
-func NewServer(st *Store) *Server {
+func NewServer(st Storage) *Server {
 	srv := Server{store: st}
 	return &srv
 }
+
+// Handler routes the requests to the endpoints of the server, failures are answered with a JSON error.
+func (server *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agenda", server.cached(server.ServeAgenda))
+	mux.HandleFunc("/agenda.ics", server.cached(server.ServeAgendaCalendar))
+	mux.HandleFunc("/news", server.cached(server.ServeNews))
+	// the feeds link to the host they were requested from, which is up to the client
+	mux.HandleFunc("/news.rss", server.validated(server.ServeNewsRSS))
+	mux.HandleFunc("/news.atom", server.validated(server.ServeNewsAtom))
+	mux.HandleFunc("/festivals", server.cached(server.ServeFestivals))
+	mux.HandleFunc("/events/", server.cached(server.ServeEvents))
+	mux.HandleFunc("/venues/", server.cached(server.ServeVenues))
+	mux.HandleFunc("/updates", server.cached(server.ServeUpdates))
+	mux.HandleFunc("/search", server.validated(server.ServeSearch))
+	return server.recovered(mux)
+}
@@ -0,0 +1,237 @@
+package wasgeit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeEvents(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+
+	if err := st.SaveEvent(Event{Title: "Band", URL: "/1", DateTime: fixtureTime, Venue: testVenue(t, st, "kairo")}); err != nil {
+		t.Fatal(err)
+	}
+
+	ev := testEvents(t, st, "kairo")[0]
+	if err := st.LogUpdate(ev.ID, FieldStatus, StatusScheduled, StatusSoldOut); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(st)
+
+	for path, expectedStatus := range map[string]int{
+		"/events/" + ev.PublicID:              http.StatusOK,
+		"/events/" + ev.PublicID + "/history": http.StatusOK,
+		"/events/unknown":                     http.StatusNotFound,
+		"/events/" + ev.PublicID + "/other":   http.StatusNotFound,
+		"/events/":                            http.StatusNotFound,
+		"/events/" + ev.PublicID + ".ics":     http.StatusOK,
+		"/events/unknown.ics":                 http.StatusNotFound,
+		"/venues/kairo/events.ics":            http.StatusOK,
+		"/venues/unknown/events.ics":          http.StatusNotFound,
+	} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+
+		if strings.HasPrefix(path, "/venues/") {
+			server.ServeVenues(recorder, request)
+		} else {
+			server.ServeEvents(recorder, request)
+		}
+
+		if recorder.Code != expectedStatus {
+			t.Errorf("expected %d for %s, got %d", expectedStatus, path, recorder.Code)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeEvents(recorder, httptest.NewRequest(http.MethodGet, "/events/"+ev.PublicID, nil))
+
+	var served JsonEventWithHistory
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+
+	if served.ID != ev.PublicID || served.Venue.ShortName != "kairo" || len(served.History) != 1 {
+		t.Errorf("unexpected event %+v", served)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+	st.Clock = FixedClock(fixtureTime)
+	if err := st.UpdateValue(LastCrawlTimeKey, fixtureTime.Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.SaveEvent(Event{Title: "Band", URL: "/1", DateTime: fixtureTime, Venue: testVenue(t, st, "kairo")}); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewServer(st).Handler()
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		for name := range header {
+			request.Header.Set(name, header.Get(name))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for _, path := range []string{"/agenda", "/news.atom", "/festivals"} {
+		response := get(path, nil)
+		etag := response.Header().Get("ETag")
+
+		if response.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) || response.Header().Get("Cache-Control") == "" {
+			t.Fatalf("expected %s to be served with validators, got %d: %v", path, response.Code, response.Header())
+		}
+
+		for name, value := range map[string]string{
+			"If-None-Match":     etag,
+			"If-Modified-Since": response.Header().Get("Last-Modified"),
+		} {
+			if conditional := get(path, http.Header{name: {value}}); conditional.Code != http.StatusNotModified {
+				t.Errorf("expected %s with %s to be answered with 304, got %d", path, name, conditional.Code)
+			}
+		}
+
+		if weak := get(path, http.Header{"If-None-Match": {`"other", W/` + etag}}); weak.Code != http.StatusNotModified {
+			t.Errorf("expected %s with a weak ETag to be answered with 304, got %d", path, weak.Code)
+		}
+	}
+
+	etag := get("/agenda", nil).Header().Get("ETag")
+
+	if err := st.SaveEvent(Event{Title: "Other band", URL: "/2", DateTime: fixtureTime, Venue: testVenue(t, st, "kairo")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if cached := get("/agenda", http.Header{"If-None-Match": {etag}}); cached.Code != http.StatusNotModified {
+		t.Errorf("expected the cached agenda until the next crawl, got %d", cached.Code)
+	}
+
+	if err := st.UpdateValue(LastCrawlTimeKey, fixtureTime.Add(time.Hour).Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+
+	if fresh := get("/agenda", http.Header{"If-None-Match": {etag}}); fresh.Code != http.StatusOK || !strings.Contains(fresh.Body.String(), "Other band") {
+		t.Errorf("expected the cache to be invalidated by the crawl, got %d: %s", fresh.Code, fresh.Body.String())
+	}
+
+	// the crawl of a single venue is stored before the whole crawl is done, it invalidates the cache as well
+	etag = get("/agenda", nil).Header().Get("ETag")
+
+	if err := st.SaveEvent(Event{Title: "Third band", URL: "/3", DateTime: fixtureTime, Venue: testVenue(t, st, "kairo")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.UpdateValue(LastVenueCrawlTimeKey("kairo"), fixtureTime.Add(time.Hour).Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+
+	if fresh := get("/agenda", http.Header{"If-None-Match": {etag}}); fresh.Code != http.StatusOK || !strings.Contains(fresh.Body.String(), "Third band") {
+		t.Errorf("expected the cache to be invalidated by the crawl of the venue, got %d: %s", fresh.Code, fresh.Body.String())
+	}
+}
+
+func TestResponseCacheIsBounded(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+	st.Clock = FixedClock(fixtureTime)
+
+	server := NewServer(st)
+	handler := server.Handler()
+
+	get := func(target string, host string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		request.Host = host
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	get("/agenda?venue=kairo&q=rock", "a.example")
+	get("/agenda?q=rock&venue=kairo", "b.example")
+
+	if n := server.cache.len(); n != 1 {
+		t.Errorf("expected one response regardless of the host and the order of the query, got %d", n)
+	}
+
+	get("/search?q=rock", "a.example")
+
+	for _, target := range []string{"/news.atom", "/news.rss"} {
+		if response := get(target, "a.example"); response.Header().Get("ETag") == "" {
+			t.Errorf("expected %s to be served with validators, got %d", target, response.Code)
+		}
+	}
+
+	if n := server.cache.len(); n != 1 {
+		t.Errorf("expected searches and feeds not to be cached, got %d responses", n)
+	}
+
+	if vary := get("/news.atom", "a.example").Header().Get("Vary"); !strings.Contains(vary, "Host") {
+		t.Errorf("expected the feed to vary by host, got %q", vary)
+	}
+
+	for i := 0; i < maxCachedResponses+10; i++ {
+		get("/agenda?q="+strconv.Itoa(i), "a.example")
+	}
+
+	if n := server.cache.len(); n != maxCachedResponses {
+		t.Errorf("expected the cache to hold at most %d responses, got %d", maxCachedResponses, n)
+	}
+}
+
+func TestServeAgendaValidation(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+
+	server := NewServer(st)
+
+	for _, query := range []string{"from=tomorrow", "to=2019-13-01", "venue=unknown", "limit=0", "limit=x", "sort=title", "cursor=x"} {
+		recorder := httptest.NewRecorder()
+		server.ServeAgenda(recorder, httptest.NewRequest(http.MethodGet, "/agenda?"+query, nil))
+
+		var body map[string]string
+
+		if recorder.Code != http.StatusBadRequest || json.Unmarshal(recorder.Body.Bytes(), &body) != nil || body["error"] == "" {
+			t.Errorf("expected a JSON error for %s, got %d: %s", query, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeAgenda(recorder, httptest.NewRequest(http.MethodGet, "/agenda?venue=kairo,dachstock&from=2019-06-01&to=2019-06-30&q=rock", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected a valid query, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRecovered(t *testing.T) {
+	server := Server{}
+	handler := server.recovered(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("broken")
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/agenda", nil))
+
+	var body JsonError
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder.Code != http.StatusInternalServerError || body.Error == "" {
+		t.Errorf("expected a JSON error, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
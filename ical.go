@@ -0,0 +1,197 @@
+package wasgeit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Revision tells how often an event was changed, see Store.FindRevisions.
+type Revision struct {
+	// Sequence is the number of changes logged for the event
+	Sequence     int
+	LastModified time.Time
+}
+
+// calendarTimezone describes the timezone of the venues, Europe/Zurich follows the EU daylight saving rules since 1996.
+const calendarTimezone = `BEGIN:VTIMEZONE
+TZID:Europe/Zurich
+BEGIN:DAYLIGHT
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+TZNAME:CEST
+DTSTART:19810329T020000
+RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU
+END:DAYLIGHT
+BEGIN:STANDARD
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+TZNAME:CET
+DTSTART:19961027T030000
+RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU
+END:STANDARD
+END:VTIMEZONE`
+
+const (
+	calendarUIDDomain = "wasgeit"
+	calendarUTCFormat = "20060102T150405Z"
+	calendarLocal     = "20060102T150405"
+	calendarDate      = "20060102"
+	// calendarLineLength is the maximum length of a line in octets, longer lines are folded
+	calendarLineLength = 75
+)
+
+// WriteCalendar writes the events as iCalendar (RFC 5545). The revisions of the events, keyed by their ID, bump the
+// SEQUENCE of the entries so calendar apps pick up changes.
+func WriteCalendar(w io.Writer, name string, events []Event, revisions map[int64]Revision) error {
+	cw := calendarWriter{w: bufio.NewWriter(w)}
+
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//wasgeit//agenda//EN")
+	cw.line("CALSCALE:GREGORIAN")
+	cw.property("X-WR-CALNAME", name)
+	cw.line("X-WR-TIMEZONE:Europe/Zurich")
+
+	for _, line := range strings.Split(calendarTimezone, "\n") {
+		cw.line(line)
+	}
+
+	for _, ev := range events {
+		cw.event(ev, revisions[ev.ID])
+	}
+
+	cw.line("END:VCALENDAR")
+
+	if cw.err != nil {
+		return cw.err
+	}
+
+	return cw.w.Flush()
+}
+
+type calendarWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (cw *calendarWriter) event(ev Event, revision Revision) {
+	lastModified := ev.Created
+	if revision.LastModified.After(lastModified) {
+		lastModified = revision.LastModified
+	}
+
+	cw.line("BEGIN:VEVENT")
+	cw.line("UID:" + ev.PublicID + "@" + calendarUIDDomain)
+	cw.line("DTSTAMP:" + lastModified.UTC().Format(calendarUTCFormat))
+	cw.line("CREATED:" + ev.Created.UTC().Format(calendarUTCFormat))
+	cw.line("LAST-MODIFIED:" + lastModified.UTC().Format(calendarUTCFormat))
+	cw.line(fmt.Sprintf("SEQUENCE:%d", revision.Sequence))
+
+	if isMidnight(ev.DateTime) && ev.EndDateTime.IsZero() {
+		// the venue did not publish a start time
+		cw.line("DTSTART;VALUE=DATE:" + ev.DateTime.In(location).Format(calendarDate))
+	} else {
+		cw.line("DTSTART;TZID=Europe/Zurich:" + ev.DateTime.In(location).Format(calendarLocal))
+
+		if !ev.EndDateTime.IsZero() {
+			cw.line("DTEND;TZID=Europe/Zurich:" + ev.EndDateTime.In(location).Format(calendarLocal))
+		}
+	}
+
+	cw.property("SUMMARY", ev.Title)
+	cw.property("LOCATION", ev.Venue.Name)
+
+	if ev.URL != "" {
+		cw.line("URL:" + ev.URL)
+	}
+
+	if description := calendarDescription(ev); description != "" {
+		cw.property("DESCRIPTION", description)
+	}
+
+	if len(ev.Genres) > 0 {
+		cw.property("CATEGORIES", ev.Genres...)
+	}
+
+	cw.line("STATUS:" + calendarStatus(ev))
+	cw.line("END:VEVENT")
+}
+
+// calendarStatus maps the status of an event onto the statuses of iCalendar, removed events are cancelled.
+func calendarStatus(ev Event) string {
+	switch {
+	case !ev.Removed.IsZero() || ev.Status == StatusCancelled:
+		return "CANCELLED"
+	case ev.Status == StatusPostponed:
+		return "TENTATIVE"
+	default:
+		return "CONFIRMED"
+	}
+}
+
+func calendarDescription(ev Event) string {
+	var paragraphs []string
+
+	if ev.Status == StatusSoldOut {
+		paragraphs = append(paragraphs, "Sold out")
+	}
+
+	if ev.Description != "" {
+		paragraphs = append(paragraphs, ev.Description)
+	}
+
+	if len(ev.Support) > 0 {
+		paragraphs = append(paragraphs, "Support: "+strings.Join(ev.Support, ", "))
+	}
+
+	if ev.Price != nil {
+		paragraphs = append(paragraphs, "Price: "+ev.Price.String())
+	}
+
+	if ev.TicketURL != "" {
+		paragraphs = append(paragraphs, "Tickets: "+ev.TicketURL)
+	}
+
+	return strings.Join(paragraphs, "\n\n")
+}
+
+var calendarEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// property writes a property with text values, which are escaped and separated by commas.
+func (cw *calendarWriter) property(name string, values ...string) {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = calendarEscaper.Replace(value)
+	}
+	cw.line(name + ":" + strings.Join(escaped, ","))
+}
+
+// line writes a content line, folding it after calendarLineLength octets without splitting characters.
+func (cw *calendarWriter) line(line string) {
+	if cw.err != nil {
+		return
+	}
+
+	limit := calendarLineLength
+
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		if _, cw.err = cw.w.WriteString(line[:cut] + "\r\n "); cw.err != nil {
+			return
+		}
+
+		line = line[cut:]
+		// continuation lines start with a blank
+		limit = calendarLineLength - 1
+	}
+
+	_, cw.err = cw.w.WriteString(line + "\r\n")
+}
@@ -0,0 +1,74 @@
+package wasgeit
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCalendar(t *testing.T) {
+	created := time.Date(2019, time.June, 1, 10, 0, 0, 0, time.UTC)
+	events := []Event{
+		{
+			ID:          1,
+			PublicID:    "kairo-1",
+			Title:       "Band; with, commas",
+			DateTime:    time.Date(2019, time.June, 20, 20, 30, 0, 0, location),
+			EndDateTime: time.Date(2019, time.June, 20, 23, 0, 0, 0, location),
+			Created:     created,
+			Venue:       Venue{Name: "Café Kairo"},
+			Description: strings.Repeat("Très long ", 10),
+		},
+		{
+			ID:       2,
+			PublicID: "kairo-2",
+			Title:    "Gone",
+			DateTime: time.Date(2019, time.June, 21, 0, 0, 0, 0, location),
+			Created:  created,
+			Removed:  created.Add(time.Hour),
+		},
+	}
+
+	revisions := map[int64]Revision{1: {Sequence: 2, LastModified: created.Add(48 * time.Hour)}}
+
+	var b bytes.Buffer
+
+	if err := WriteCalendar(&b, "wasgeit", events, revisions); err != nil {
+		t.Fatal(err)
+	}
+
+	calendar := b.String()
+
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"TZID:Europe/Zurich\r\n",
+		"UID:kairo-1@wasgeit\r\n",
+		"SEQUENCE:2\r\n",
+		"LAST-MODIFIED:20190603T100000Z\r\n",
+		"DTSTART;TZID=Europe/Zurich:20190620T203000\r\n",
+		"DTEND;TZID=Europe/Zurich:20190620T230000\r\n",
+		`SUMMARY:Band\; with\, commas` + "\r\n",
+		"UID:kairo-2@wasgeit\r\nDTSTAMP:20190601T100000Z\r\n",
+		"SEQUENCE:0\r\n",
+		"DTSTART;VALUE=DATE:20190621\r\n",
+		"STATUS:CANCELLED\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(calendar, expected) {
+			t.Errorf("expected %q in calendar:\n%s", expected, calendar)
+		}
+	}
+
+	for _, line := range strings.Split(calendar, "\r\n") {
+		if len(line) > calendarLineLength {
+			t.Errorf("line is not folded: %q", line)
+		}
+	}
+
+	unfolded := strings.Replace(calendar, "\r\n ", "", -1)
+
+	if !strings.Contains(unfolded, "DESCRIPTION:"+strings.TrimSpace(strings.Repeat("Très long ", 10))) {
+		t.Errorf("description was not folded properly:\n%s", calendar)
+	}
+}
@@ -0,0 +1,110 @@
+package wasgeit
+
+import (
+	"time"
+)
+
+const (
+	defaultFuzzyThreshold = 0.8
+	defaultFuzzyWindow    = 24 * time.Hour
+	dayKeyFormat          = "2006-01-02"
+)
+
+// eventIndex looks up existing events by identity and by day. Every existing event can be claimed by one new event
+// only.
+type eventIndex struct {
+	events     []Event
+	cr         Crawler
+	byIdentity map[string][]int
+	byDay      map[string][]int
+	titles     []string
+	claimed    []bool
+	threshold  float64
+	window     time.Duration
+}
+
+func newEventIndex(events []Event, cr Crawler, opts TrackingOptions) *eventIndex {
+	index := &eventIndex{
+		events:     events,
+		cr:         cr,
+		byIdentity: make(map[string][]int),
+		byDay:      make(map[string][]int),
+		titles:     make([]string, len(events)),
+		claimed:    make([]bool, len(events)),
+		threshold:  opts.FuzzyThreshold,
+		window:     opts.FuzzyWindow,
+	}
+
+	if index.threshold == 0 {
+		index.threshold = defaultFuzzyThreshold
+	}
+
+	if index.window <= 0 {
+		index.window = defaultFuzzyWindow
+	}
+
+	for i, ev := range events {
+		identity := cr.Identity(ev)
+		index.byIdentity[identity] = append(index.byIdentity[identity], i)
+
+		day := dayKey(ev.DateTime)
+		index.byDay[day] = append(index.byDay[day], i)
+
+		index.titles[i] = Normalize(ev.Title)
+	}
+
+	return index
+}
+
+// claimByIdentity returns the first unclaimed event with the same identity.
+func (index *eventIndex) claimByIdentity(ev Event) (int, bool) {
+	for _, i := range index.byIdentity[index.cr.Identity(ev)] {
+		if !index.claimed[i] {
+			index.claimed[i] = true
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// claimBySimilarity returns the unclaimed event within the date window whose title is the most similar, provided it
+// is similar enough.
+func (index *eventIndex) claimBySimilarity(ev Event) (int, bool) {
+	if index.threshold < 0 {
+		return 0, false
+	}
+
+	title := Normalize(ev.Title)
+	best, bestScore := 0, 0.0
+
+	for day := ev.DateTime.Add(-index.window); !day.After(ev.DateTime.Add(index.window).Add(24 * time.Hour)); day = day.Add(24 * time.Hour) {
+		for _, i := range index.byDay[dayKey(day)] {
+			if index.claimed[i] || absDuration(index.events[i].DateTime.Sub(ev.DateTime)) > index.window {
+				continue
+			}
+
+			if score := similarity(title, index.titles[i]); score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+	}
+
+	if bestScore < index.threshold {
+		return 0, false
+	}
+
+	index.claimed[best] = true
+	return best, true
+}
+
+// dayKey is the date in Zurich, events read from the database are in UTC.
+func dayKey(t time.Time) string {
+	return t.In(location).Format(dayKeyFormat)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,393 @@
+package wasgeit
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// schemaVersion is the version of the schema this build works with, it is the number of the latest migration.
+const schemaVersion = 7
+
+// noSchema is the version of an empty database. On SQLite, version 0 is the schema of create-schema.sql and
+// insert-venues.sql, the versions above are the migrations in sql/migrations. PostgreSQL starts with
+// postgresBaselineVersion, see schemaScripts. All of them are embedded, see assets.
+const noSchema = -1
+
+// legacyFestivalsVersion is assumed for databases set up before versions were recorded if the festivals migration
+// was applied by hand.
+const legacyFestivalsVersion = 1
+
+var migrationFilename = regexp.MustCompile(`^(\d+)-([\w-]+?)(\.down)?\.sql$`)
+
+// Migration changes the schema from the previous version to Version.
+type Migration struct {
+	Version int
+	Name    string
+	// Applied is zero if the migration is pending or was applied before versions were recorded
+	Applied  time.Time
+	up       string
+	down     string
+	baseline bool
+}
+
+// Reversible tells whether the migration can be reverted by Store.MigrateTo.
+func (m Migration) Reversible() bool {
+	return m.down != ""
+}
+
+// readMigrations reads the baseline schema followed by the migrations up to schemaVersion.
+func readMigrations(scripts schemaScripts) ([]Migration, error) {
+	var baseline []string
+
+	for _, file := range scripts.baseline {
+		script, err := readAsset(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		baseline = append(baseline, script)
+	}
+
+	migrations := []Migration{{
+		Version:  scripts.baselineVersion,
+		Name:     "initial schema",
+		up:       strings.Join(baseline, "\n"),
+		baseline: true,
+	}}
+
+	files, err := assets.ReadDir(scripts.migrationsDir)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading the migrations failed: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, file := range files {
+		match := migrationFilename.FindStringSubmatch(file.Name())
+
+		if match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, exists := byVersion[version]
+
+		if !exists {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %q and %q", version, m.Name, match[2])
+		}
+
+		script, err := readAsset(path.Join(scripts.migrationsDir, file.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] != "" {
+			m.down = script
+		} else {
+			m.up = script
+		}
+	}
+
+	for version := scripts.baselineVersion + 1; version <= schemaVersion; version++ {
+		m, exists := byVersion[version]
+
+		if !exists || m.up == "" {
+			return nil, fmt.Errorf("migration %d is missing in %s", version, scripts.migrationsDir)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	return migrations, nil
+}
+
+// SchemaVersion returns the version of the schema of the database, see noSchema.
+func (store *Store) SchemaVersion() (int, error) {
+	if err := store.recordLegacyVersion(); err != nil {
+		return noSchema, err
+	}
+
+	return schemaVersionOf(store.db)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func schemaVersionOf(db queryRower) (int, error) {
+	var version sql.NullInt64
+
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return noSchema, fmt.Errorf("reading schema version failed: %v", err)
+	}
+
+	if !version.Valid {
+		return noSchema, nil
+	}
+
+	return int(version.Int64), nil
+}
+
+// recordLegacyVersion creates the table holding the versions. For databases set up before the versions were recorded,
+// the version is derived from the schema.
+func (store *Store) recordLegacyVersion() error {
+	exists, err := store.tableExists("schema_migrations")
+
+	if err != nil || exists {
+		return err
+	}
+
+	legacy, err := store.tableExists("events")
+
+	if err != nil {
+		return err
+	}
+
+	legacyVersion := 0
+
+	if festivals, err := store.columnExists("venues", "placement"); err != nil {
+		return err
+	} else if festivals {
+		legacyVersion = legacyFestivalsVersion
+	}
+
+	tx, err := store.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(store.db.dialect.scripts().versionTable); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+
+	if legacy {
+		log.Infof("Database was set up before schema versions were recorded, assuming version %d", legacyVersion)
+
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, legacyVersion); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record legacy schema version: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (store *Store) tableExists(name string) (bool, error) {
+	var count int
+	err := store.db.QueryRow(store.db.dialect.tableExists(), name).Scan(&count)
+	return count > 0, err
+}
+
+func (store *Store) columnExists(table string, column string) (bool, error) {
+	var count int
+	err := store.db.QueryRow(store.db.dialect.columnExists(), table, column).Scan(&count)
+	return count > 0, err
+}
+
+// Migrations returns the migrations known to this build along with the time they were applied.
+func (store *Store) Migrations() ([]Migration, int, error) {
+	current, err := store.SchemaVersion()
+
+	if err != nil {
+		return nil, current, err
+	}
+
+	migrations, err := readMigrations(store.db.dialect.scripts())
+
+	if err != nil {
+		return nil, current, err
+	}
+
+	baseline := migrations[0].Version
+
+	rows, err := store.db.Query(`SELECT version, applied FROM schema_migrations WHERE applied IS NOT NULL`)
+
+	if err != nil {
+		return nil, current, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var applied time.Time
+
+		if err := rows.Scan(&version, &applied); err != nil {
+			return nil, current, err
+		}
+
+		if version >= baseline && version-baseline < len(migrations) {
+			migrations[version-baseline].Applied = applied
+		}
+	}
+
+	return migrations, current, rows.Err()
+}
+
+// Migrate brings the schema of the database to the version of this build and sets up the search index if it is
+// missing, see ensureSearchIndex.
+func (store *Store) Migrate() error {
+	if err := store.MigrateTo(schemaVersion); err != nil {
+		return err
+	}
+
+	return store.ensureSearchIndex()
+}
+
+// MigrateTo applies or reverts migrations until the schema has the given version. Each migration is applied in a
+// transaction of its own. Databases with a schema newer than this build are refused.
+func (store *Store) MigrateTo(target int) error {
+	if store.db == nil {
+		return fmt.Errorf("need to connect to DB first")
+	}
+
+	current, err := store.SchemaVersion()
+
+	if err != nil {
+		return err
+	}
+
+	if current > schemaVersion {
+		return fmt.Errorf("schema version %d of the database is newer than version %d of this build", current, schemaVersion)
+	}
+
+	scripts := store.db.dialect.scripts()
+
+	if target < scripts.baselineVersion || target > schemaVersion {
+		return fmt.Errorf("there is no schema version %d, the versions range from %d to %d", target,
+			scripts.baselineVersion, schemaVersion)
+	}
+
+	migrations, err := readMigrations(scripts)
+
+	if err != nil {
+		return err
+	}
+
+	from := current + 1
+
+	if from < scripts.baselineVersion {
+		// empty databases start with the baseline
+		from = scripts.baselineVersion
+	}
+
+	for version := from; version <= target; version++ {
+		if err := store.applyMigration(migrations[version-scripts.baselineVersion], false); err != nil {
+			return err
+		}
+	}
+
+	for version := current; version > target; version-- {
+		if err := store.applyMigration(migrations[version-scripts.baselineVersion], true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (store *Store) applyMigration(m Migration, revert bool) error {
+	script, expected, action := m.up, m.Version-1, "apply"
+
+	if revert {
+		script, expected, action = m.down, m.Version, "revert"
+
+		if !m.Reversible() {
+			return fmt.Errorf("migration %d %q cannot be reverted", m.Version, m.Name)
+		}
+	}
+
+	if m.baseline {
+		expected = noSchema
+	}
+
+	tx, err := store.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	// another process may have migrated in the meantime
+	if current, err := schemaVersionOf(tx); err != nil || current != expected {
+		tx.Rollback()
+		return fmt.Errorf("failed to %s migration %d %q, expected schema version %d but found %d (%v)", action,
+			m.Version, m.Name, expected, current, err)
+	}
+
+	if _, err := tx.Exec(script); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to %s migration %d %q: %v", action, m.Version, m.Name, err)
+	}
+
+	if revert {
+		if err := store.keepSearchIndex(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to keep the search index reverting migration %d %q: %v", m.Version, m.Name, err)
+		}
+
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version >= ?`, m.Version)
+	} else {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, applied) VALUES (?, ?)`, m.Version, time.Now().UTC())
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record schema version %d: %v", m.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if revert {
+		log.Infof("Reverted migration %d %q", m.Version, m.Name)
+	} else {
+		log.Infof("Applied migration %d %q", m.Version, m.Name)
+	}
+
+	return nil
+}
+
+// keepSearchIndex recreates the triggers keeping the search index in sync, as the down scripts copy the events table
+// without them. Schemas lacking the indexed columns lose the index, Migrate sets it up again.
+func (store *Store) keepSearchIndex(tx *transaction) error {
+	var count int
+
+	if err := tx.QueryRow(tx.dialect.tableExists(), "events_search").Scan(&count); err != nil || count == 0 {
+		return err
+	}
+
+	for _, column := range []string{"title", "description", "support"} {
+		if err := tx.QueryRow(tx.dialect.columnExists(), "events", column).Scan(&count); err != nil {
+			return err
+		}
+
+		if count == 0 {
+			_, err := tx.Exec(`DROP TABLE events_search`)
+			return err
+		}
+	}
+
+	script, err := readAsset("sql/create-search.sql")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(script)
+	return err
+}
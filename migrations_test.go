@@ -0,0 +1,163 @@
+package wasgeit
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestMigrateDownAndUp(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+
+	if version, err := st.SchemaVersion(); err != nil || version != schemaVersion {
+		t.Fatalf("expected version %d, got %d (%v)", schemaVersion, version, err)
+	}
+
+	ev := Event{Title: "Band", URL: "/1", DateTime: fixtureTime.Add(24 * time.Hour), Venue: testVenue(t, st, "kairo")}
+
+	if err := st.SaveEvent(ev); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.db.Exec(`INSERT INTO venues (url, name, shortname, placement) VALUES (?, ?, ?, ?)`,
+		"https://gurtenfestival.ch", "Gurtenfestival", "gurtenfestival", "what-else"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.MigrateTo(0); err != nil {
+		t.Fatal(err)
+	}
+
+	var venues int
+
+	if err := st.db.QueryRow(`SELECT COUNT(*) FROM venues WHERE shortname = ?`, "gurtenfestival").Scan(&venues); err != nil || venues != 1 {
+		t.Errorf("expected the festival to be kept as venue, got %d (%v)", venues, err)
+	}
+
+	if err := st.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := testEvents(t, st, "kairo")
+
+	if len(events) != 1 || events[0].Title != "Band" || events[0].PublicID == "" {
+		t.Errorf("expected the event to survive the migrations, got %+v", events)
+	}
+
+	if testVenue(t, st, "roessli").Building == "" {
+		t.Error("expected the shared venues to be set up again")
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetMaxOpenConns(1)
+	st := newStore(db, sqliteDialect{})
+	defer st.Close()
+
+	// a database set up before versions were recorded, with the festivals migration applied by hand
+	for _, file := range []string{"sql/create-schema.sql", "sql/insert-venues.sql", "sql/migrations/1-festivals.sql"} {
+		script, err := readAsset(file)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec(script); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if version, err := st.SchemaVersion(); err != nil || version != legacyFestivalsVersion {
+		t.Fatalf("expected legacy version %d, got %d (%v)", legacyFestivalsVersion, version, err)
+	}
+
+	if err := st.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.GetCurrentFestivals(); err != nil {
+		t.Errorf("expected the festivals to be readable, got %v", err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, schemaVersion+1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Migrate(); err == nil {
+		t.Error("expected a newer schema to be refused")
+	}
+}
+
+func TestDialectsReachSchemaVersion(t *testing.T) {
+	for name, d := range map[string]dialect{"sqlite": sqliteDialect{}, "postgres": postgresDialect{}} {
+		migrations, err := readMigrations(d.scripts())
+
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if last := migrations[len(migrations)-1]; last.Version != schemaVersion {
+			t.Errorf("%s: expected the migrations to reach version %d, got %d", name, schemaVersion, last.Version)
+		}
+	}
+}
+
+func TestLoggedTimesMigration(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+
+	if err := st.MigrateTo(6); err != nil {
+		t.Fatal(err)
+	}
+
+	// the format go-sqlite3 wrote times in before
+	if _, err := st.db.Exec(`INSERT INTO updates (event_id, field, old, new) VALUES (?, ?, ?, ?)`,
+		1, FieldDate, "2019-06-20 20:30:00+02:00", "Broken"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.LogUpdate(1, FieldDate, time.Date(2019, time.June, 21, 20, 30, 0, 0, location), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := st.db.Query(`SELECT old FROM updates ORDER BY id`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var logged []time.Time
+
+	for rows.Next() {
+		var old string
+
+		if err := rows.Scan(&old); err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := ParseLoggedTime(old)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		logged = append(logged, parsed)
+	}
+
+	if len(logged) != 2 || logged[1].Sub(logged[0]) != 24*time.Hour {
+		t.Errorf("expected both times to be logged as RFC 3339, got %v", logged)
+	}
+}
@@ -0,0 +1,84 @@
+package wasgeit
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// umlauts are spelled out the way they are written without umlauts, so "Bierhübeli" and "Bierhuebeli" are the same.
+var umlauts = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", "æ", "ae", "œ", "oe")
+
+// Normalize folds a text for comparisons and searches: it is lower cased, umlauts are spelled out, other diacritics
+// are dropped (é becomes e), punctuation is replaced by blanks and whitespace is collapsed.
+func Normalize(s string) string {
+	s = umlauts.Replace(strings.ToLower(s))
+
+	var b strings.Builder
+	blank := true
+
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// combining marks left over from decomposing é into e and ´
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			b.WriteRune(r)
+			blank = false
+		case !blank:
+			b.WriteRune(' ')
+			blank = true
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// similarity compares two normalized texts, 1 means equal and 0 means completely different. It is based on the
+// Levenshtein distance relative to the length of the longer text.
+func similarity(s1 string, s2 string) float64 {
+	r1, r2 := []rune(s1), []rune(s2)
+	longest := len(r1)
+	if len(r2) > longest {
+		longest = len(r2)
+	}
+
+	if longest == 0 {
+		return 1
+	}
+
+	return 1 - float64(levenshtein(r1, r2))/float64(longest)
+}
+
+func levenshtein(r1 []rune, r2 []rune) int {
+	previous := make([]int, len(r2)+1)
+	current := make([]int, len(r2)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(r1); i++ {
+		current[0] = i
+		for j := 1; j <= len(r2); j++ {
+			cost := 1
+			if r1[i-1] == r2[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(r2)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
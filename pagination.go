@@ -0,0 +1,95 @@
+package wasgeit
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const defaultMaxPages = 10
+
+// Pagination describes how to get from one page of a venue's programme to the next. Either the link to the next page
+// is looked up with NextSelector, or the pages are built with URLTemplate for each of the upcoming Months.
+type Pagination struct {
+	// NextSelector matches the link to the next page, its href is resolved against the current page
+	NextSelector string
+	// URLTemplate is a text/template receiving a PageData, e.g. "https://example.org/agenda?month={{.Month}}&year={{.Year}}"
+	URLTemplate *template.Template
+	// Months is the number of months covered by URLTemplate, starting with the current one
+	Months int
+	// MaxPages limits the number of pages fetched, defaults to 10
+	MaxPages int
+}
+
+// PageData is passed to Pagination.URLTemplate.
+type PageData struct {
+	Year  int
+	Month int
+	// Page starts at 1
+	Page int
+}
+
+func (p Pagination) maxPages() int {
+	max := p.MaxPages
+	if max <= 0 {
+		max = defaultMaxPages
+	}
+	if p.URLTemplate != nil && p.Months > 0 && p.Months < max {
+		max = p.Months
+	}
+	return max
+}
+
+func (cr *HTMLCrawler) URL() string {
+	if cr.config.Pagination.URLTemplate != nil {
+		if url, err := cr.pageFromTemplate(0); err == nil {
+			return url
+		}
+	}
+	return cr.venue.URL
+}
+
+// NextURL returns the URL of the page following pageURL, or an empty string if pageURL was the last page.
+func (cr *HTMLCrawler) NextURL(pageURL string, body string, pageCount int) (string, error) {
+	pagination := cr.config.Pagination
+
+	if pageCount >= pagination.maxPages() {
+		return "", nil
+	}
+
+	if pagination.URLTemplate != nil {
+		return cr.pageFromTemplate(pageCount)
+	}
+
+	if pagination.NextSelector != "" {
+		dom, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+
+		if err != nil {
+			return "", err
+		}
+
+		if href, exists := dom.Find(pagination.NextSelector).First().Attr("href"); exists && href != "" {
+			return resolveRelative(pageURL, href), nil
+		}
+	}
+
+	return "", nil
+}
+
+func (cr *HTMLCrawler) pageFromTemplate(pageIndex int) (string, error) {
+	now := orSystemClock(cr.clock).Now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, pageIndex, 0)
+
+	var url bytes.Buffer
+	err := cr.config.Pagination.URLTemplate.Execute(&url, PageData{Year: month.Year(), Month: int(month.Month()), Page: pageIndex + 1})
+
+	if err != nil {
+		return "", fmt.Errorf("could not build URL of page %d: %v", pageIndex+1, err)
+	}
+
+	return url.String(), nil
+}
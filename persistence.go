@@ -2,30 +2,44 @@ package wasgeit
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
 )
 
-const schemaVersion = 1
-
+// Store implements Storage on top of SQLite or PostgreSQL.
 type Store struct {
-	db *sql.DB
+	db *database
+	// Clock defines "now" for queries like GetEventsYetToHappen, defaults to the system clock.
+	Clock Clock
 }
 
-func (store *Store) Connect() error {
-	var err error
+func newStore(db *sql.DB, d dialect) *Store {
+	return &Store{db: &database{DB: db, dialect: d}}
+}
 
-	store.db, err = sql.Open("sqlite3", "db/wasgeit.db")
+// Connect opens the database of the DSN, see dialectOf.
+func (store *Store) Connect(dsn string) error {
+	d := dialectOf(dsn)
+	db, err := sql.Open(d.driver(), dsn)
 
 	if err != nil {
 		return err
 	}
 
+	store.db = &database{DB: db, dialect: d}
+
 	return nil
 }
 
+func (store *Store) Now() time.Time {
+	return orSystemClock(store.Clock).Now()
+}
+
 func (store *Store) Close() error {
 	if store.db != nil {
 		return store.db.Close()
@@ -35,9 +49,9 @@ func (store *Store) Close() error {
 }
 
 func (store *Store) FindVenue(shortName string) (Venue, error) {
-	row := store.db.QueryRow("SELECT id, name, shortname, url FROM venues WHERE shortname = ?", shortName)
+	row := store.db.QueryRow("SELECT id, name, shortname, url, building FROM venues WHERE shortname = ?", shortName)
 	var v Venue
-	err := row.Scan(&v.ID, &v.Name, &v.ShortName, &v.URL)
+	err := row.Scan(&v.ID, &v.Name, &v.ShortName, &v.URL, &v.Building)
 
 	if err == sql.ErrNoRows {
 		return Venue{}, fmt.Errorf("could not find venue %q", shortName)
@@ -47,181 +61,708 @@ func (store *Store) FindVenue(shortName string) (Venue, error) {
 	return v, nil
 }
 
-func (store *Store) GetVenue(shortName string) Venue {
-	venue, err := store.FindVenue(shortName)
-
-	if err != nil {
-		panic(err)
-	}
-	return venue
-}
-
-func (store *Store) FindEvents(crawlerName string) []Event {
-	rows, err := store.db.Query(`SELECT 
-		events.id, 
-		events.title, 
-		events.date, 
-		events.url, 
-		events.created,
-		venues.id,
-		venues.name,
-		venues.shortname,
-		venues.url
+// eventColumns are the columns read by mapRowsToEvents.
+const eventColumns = `
+	events.id,
+	events.public_id,
+	events.title,
+	events.date,
+	events.url,
+	events.created,
+	events.status,
+	events.description,
+	events.price_min,
+	events.price_max,
+	events.currency,
+	events.doors,
+	events.end_date,
+	events.genres,
+	events.support,
+	events.image_url,
+	events.ticket_url,
+	events.missing_crawls,
+	events.removed,
+	events.removal_reason,
+	events.canonical_id,
+	venues.id,
+	venues.name,
+	venues.shortname,
+	venues.url,
+	venues.building`
+
+func (store *Store) FindEvents(crawlerName string) ([]Event, error) {
+	rows, err := store.db.Query(`SELECT `+eventColumns+`
 		FROM events 
 		JOIN venues ON venues.shortname = events.venue
 		WHERE venue = ?`,
 		crawlerName)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("querying events of %q failed: %v", crawlerName, err)
 	}
 	defer rows.Close()
 
 	return mapRowsToEvents(rows)
 }
 
+const (
+	insertEventQuery = `insert into events(public_id, title, date, url, venue, status, description, price_min, price_max,
+		currency, doors, end_date, genres, support, image_url, ticket_url)
+		values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	insertUpdateQuery     = `INSERT INTO updates (event_id, field, old, new) VALUES (?, ?, ?, ?)`
+	insertErrorQuery      = `INSERT INTO errors (crawler, msg) VALUES (?, ?)`
+	setMissingCrawlsQuery = `UPDATE events SET missing_crawls = ? WHERE id = ?`
+	markEventRemovedQuery = `UPDATE events SET missing_crawls = ?, removed = ?, removal_reason = ? WHERE id = ?`
+	restoreEventQuery     = `UPDATE events SET missing_crawls = 0, removed = NULL, removal_reason = '' WHERE id = ?`
+)
+
 func (store *Store) SaveEvent(ev Event) error {
-	return store.inTransaction(`insert into events(title, date, url, venue) values(?, ?, ?, ?)`, func(stmt *sql.Stmt) (sql.Result, error) {
-		return stmt.Exec(ev.Title, ev.DateTime, ev.URL, ev.Venue.ShortName)
+	return store.inTransaction(insertEventQuery, func(stmt *sql.Stmt) (sql.Result, error) {
+		return stmt.Exec(insertEventArgs(ev)...)
 	}, func(err error) error {
 		return fmt.Errorf("failed to persists event %v: %s", ev, err)
 	})
 }
 
-func (store *Store) GetEventsYetToHappen() []Event {
-	rows, err := store.db.Query(`SELECT 
-								events.id, 
-								events.title, 
-								events.date, 
-								events.url, 
-								events.created,
-								venues.id,
-								venues.name,
-								venues.shortname,
-								venues.url
+// insertEventArgs returns the values of insertEventQuery, events without public ID are given one.
+func insertEventArgs(ev Event) []interface{} {
+	if ev.PublicID == "" {
+		ev.PublicID = PublicEventID(ev.Venue.ShortName, titleAndDateIdentity(ev), ev.DateTime)
+	}
+
+	args := []interface{}{ev.PublicID, ev.Title, ev.DateTime, ev.URL, ev.Venue.ShortName}
+	for _, field := range []string{FieldStatus, FieldDescription, FieldPrice, FieldDoors, FieldEndDate, FieldGenres,
+		FieldSupport, FieldImageURL, FieldTicketURL} {
+		args = append(args, columnValues(field, ev.FieldValue(field))...)
+	}
+	return args
+}
+
+func (store *Store) GetEventsYetToHappen() ([]Event, error) {
+	rows, err := store.db.Query(`SELECT `+eventColumns+`
 								FROM events 
 								JOIN venues ON venues.shortname = events.venue 
-								WHERE date(date) > DATE('now', '-1 day')`)
+								WHERE `+store.db.dialect.date("events.date")+` >= `+store.db.dialect.date("?")+`
+									AND events.removed IS NULL AND events.canonical_id IS NULL`, store.Now())
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("querying upcoming events failed: %v", err)
 	}
 	defer rows.Close()
 
-	return mapRowsToEvents(rows)
+	return store.withSourceVenues(mapRowsToEvents(rows))
 }
 
-func (store *Store) GetEventsAddedDuringLastWeek() []Event {
-	rows, err := store.db.Query(`SELECT 
-								events.id, 
-								events.title, 
-								events.date, 
-								events.url,
-								events.created, 
-								venues.id,
-								venues.name,
-								venues.shortname,
-								venues.url
+func (store *Store) GetEventsAddedDuringLastWeek() ([]Event, error) {
+	rows, err := store.db.Query(`SELECT `+eventColumns+`
 								FROM events 
 								JOIN venues ON venues.shortname = events.venue
-								WHERE date(created) > DATE('now', '-7 day') ORDER BY created DESC`)
+								WHERE `+store.db.dialect.date("events.created")+` > `+store.db.dialect.date("?")+`
+									AND events.removed IS NULL AND events.canonical_id IS NULL
+								ORDER BY events.created DESC`, store.Now().AddDate(0, 0, -7))
+	if err != nil {
+		return nil, fmt.Errorf("querying new events failed: %v", err)
+	}
+	defer rows.Close()
+
+	return store.withSourceVenues(mapRowsToEvents(rows))
+}
+
+// FindAgenda returns the events of the agenda selected by the query, which has to be valid. Duplicates are left out,
+// their venues count as venues of the canonical event.
+func (store *Store) FindAgenda(q AgendaQuery) (AgendaPage, error) {
+	key, err := q.sortKey()
+
+	if err != nil {
+		return AgendaPage{}, err
+	}
+
+	d := store.db.dialect
+	conditions := []string{`events.removed IS NULL`, `events.canonical_id IS NULL`}
+	var args []interface{}
+
+	if q.From.IsZero() {
+		conditions = append(conditions, d.date(`events.date`)+` >= `+d.date(`?`))
+		args = append(args, store.Now())
+	} else {
+		conditions = append(conditions, d.dateTime(`events.date`)+` >= `+d.dateTime(`?`))
+		args = append(args, q.From.UTC())
+	}
+
+	if !q.To.IsZero() {
+		conditions = append(conditions, d.dateTime(`events.date`)+` < `+d.dateTime(`?`))
+		args = append(args, q.To.UTC())
+	}
+
+	if len(q.Venues) > 0 {
+		venues := placeholders(len(q.Venues))
+		conditions = append(conditions, `(events.venue IN (`+venues+`) OR EXISTS (
+			SELECT 1 FROM events duplicates WHERE duplicates.canonical_id = events.id AND duplicates.venue IN (`+venues+`)))`)
+		for i := 0; i < 2; i++ {
+			for _, venue := range q.Venues {
+				args = append(args, venue)
+			}
+		}
+	}
+
+	for _, word := range strings.Fields(q.Text) {
+		like := ` ` + d.like() + ` ? ESCAPE '\'`
+		conditions = append(conditions, `(events.title`+like+` OR events.description`+like+` OR venues.name`+like+`)`)
+		pattern := likePattern(word)
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	comparison, order := `>`, `ASC`
+	if key.descending {
+		comparison, order = `<`, `DESC`
+	}
+
+	if q.Cursor != "" {
+		cursor, err := q.decodeCursor()
+
+		if err != nil {
+			return AgendaPage{}, err
+		}
+
+		column, value := d.dateTime(key.column), d.dateTime(`?`)
+		conditions = append(conditions, `(`+column+` `+comparison+` `+value+` OR (`+column+` = `+value+` AND events.id `+comparison+` ?))`)
+		args = append(args, cursor.time(), cursor.time(), cursor.id)
+	}
+
+	query := `SELECT ` + eventColumns + `
+		FROM events
+		JOIN venues ON venues.shortname = events.venue
+		WHERE ` + strings.Join(conditions, ` AND `) + `
+		ORDER BY ` + d.dateTime(key.column) + ` ` + order + `, events.id ` + order
+
+	if q.Limit > 0 {
+		// one more to know whether there is a next page
+		query += ` LIMIT ?`
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := store.db.Query(query, args...)
+
 	if err != nil {
-		panic(err)
+		return AgendaPage{}, fmt.Errorf("querying the agenda failed: %v", err)
+	}
+	defer rows.Close()
+
+	events, err := mapRowsToEvents(rows)
+
+	if err != nil {
+		return AgendaPage{}, err
+	}
+
+	page := AgendaPage{Events: events}
+
+	if q.Limit > 0 && len(page.Events) > q.Limit {
+		page.Events = page.Events[:q.Limit]
+		page.NextCursor = q.encodeCursor(key, page.Events[q.Limit-1])
+	}
+
+	if page.Events, err = store.withSourceVenues(page.Events, nil); err != nil {
+		return AgendaPage{}, err
+	}
+
+	return page, nil
+}
+
+// withSourceVenues attaches the venues of the duplicates linked to each of the events. It is chained to the queries
+// of the events, their error is passed on.
+func (store *Store) withSourceVenues(events []Event, err error) ([]Event, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := store.db.Query(`SELECT events.canonical_id, venues.id, venues.name, venues.shortname, venues.url, venues.building
+		FROM events
+		JOIN venues ON venues.shortname = events.venue
+		WHERE events.canonical_id IS NOT NULL AND events.removed IS NULL
+		ORDER BY events.id`)
+	if err != nil {
+		return nil, fmt.Errorf("querying duplicates failed: %v", err)
+	}
+	defer rows.Close()
+
+	sources := make(map[int64][]Venue)
+
+	for rows.Next() {
+		var canonicalID int64
+		var v Venue
+
+		if err := rows.Scan(&canonicalID, &v.ID, &v.Name, &v.ShortName, &v.URL, &v.Building); err != nil {
+			return nil, err
+		}
+		sources[canonicalID] = append(sources[canonicalID], v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range events {
+		events[i].SourceVenues = sources[events[i].ID]
+	}
+
+	return events, nil
+}
+
+// FindUpcomingEvents returns the future events of all venues which were not removed, including duplicates.
+func (store *Store) FindUpcomingEvents() ([]Event, error) {
+	rows, err := store.db.Query(`SELECT `+eventColumns+`
+		FROM events
+		JOIN venues ON venues.shortname = events.venue
+		WHERE `+store.db.dialect.date("events.date")+` >= `+store.db.dialect.date("?")+` AND events.removed IS NULL`, store.Now())
+
+	if err != nil {
+		return nil, fmt.Errorf("querying upcoming events failed: %v", err)
 	}
 	defer rows.Close()
 
 	return mapRowsToEvents(rows)
 }
 
-func mapRowsToEvents(rows *sql.Rows) []Event {
+// LinkDuplicates replaces the links between upcoming duplicates with the given clusters. The first event of each
+// cluster becomes the canonical event of the others.
+func (store *Store) LinkDuplicates(clusters [][]Event) error {
+	tx, err := store.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE events SET canonical_id = NULL
+		WHERE canonical_id IS NOT NULL AND `+store.db.dialect.date("date")+` >= `+store.db.dialect.date("?"), store.Now())
+
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to unlink duplicates: %v", err)
+	}
+
+	for _, cluster := range clusters {
+		for _, duplicate := range cluster[1:] {
+			if _, err := tx.Exec(`UPDATE events SET canonical_id = ? WHERE id = ?`, cluster[0].ID, duplicate.ID); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to link event %d to %d: %v", duplicate.ID, cluster[0].ID, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func mapRowsToEvents(rows *sql.Rows) ([]Event, error) {
 	var events []Event
 
 	for rows.Next() {
-		var ev Event
-		err := rows.Scan(&ev.ID, &ev.Title, &ev.DateTime, &ev.URL, &ev.Created, &ev.Venue.ID, &ev.Venue.Name, &ev.Venue.ShortName, &ev.Venue.URL)
+		ev, err := scanEvent(rows)
 
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+
 		events = append(events, ev)
 	}
 
-	return events
+	return events, rows.Err()
 }
 
-func (store *Store) UpdateEvent(id int64, fieldName string, value interface{}) {
-	if fieldName != "title" && fieldName != "date" {
-		panic(fmt.Sprintf("Unknown column provided for update: %q", fieldName))
+// scanEvent reads the eventColumns of the current row, preceded by the given columns.
+func scanEvent(rows *sql.Rows, preceding ...interface{}) (Event, error) {
+	var ev Event
+	var status, genres, support string
+	var priceMin, priceMax sql.NullFloat64
+	var currency sql.NullString
+	var doors, endDate, removed sql.NullTime
+	var canonicalID sql.NullInt64
+
+	err := rows.Scan(append(preceding, &ev.ID, &ev.PublicID, &ev.Title, &ev.DateTime, &ev.URL, &ev.Created, &status, &ev.Description,
+		&priceMin, &priceMax, &currency, &doors, &endDate, &genres, &support, &ev.ImageURL, &ev.TicketURL,
+		&ev.MissingCrawls, &removed, &ev.RemovalReason, &canonicalID, &ev.Venue.ID, &ev.Venue.Name, &ev.Venue.ShortName,
+		&ev.Venue.URL, &ev.Venue.Building)...)
+
+	if err != nil {
+		return Event{}, err
+	}
+
+	ev.Status = EventStatus(status)
+	ev.Doors = doors.Time
+	ev.EndDateTime = endDate.Time
+	ev.Removed = removed.Time
+	ev.CanonicalID = canonicalID.Int64
+
+	if priceMin.Valid && priceMax.Valid {
+		ev.Price = &PriceRange{Min: priceMin.Float64, Max: priceMax.Float64, Currency: currency.String}
+	}
+
+	if ev.Genres, err = unmarshalList(genres); err != nil {
+		return Event{}, err
+	}
+
+	if ev.Support, err = unmarshalList(support); err != nil {
+		return Event{}, err
+	}
+
+	return ev, nil
+}
+
+// updatableColumns lists the columns of each field which may be changed by UpdateEvent, in the order of the values
+// returned by columnValues.
+var updatableColumns = map[string][]string{
+	FieldTitle:       {"title"},
+	FieldDate:        {"date"},
+	FieldURL:         {"url"},
+	FieldStatus:      {"status"},
+	FieldDescription: {"description"},
+	FieldPrice:       {"price_min", "price_max", "currency"},
+	FieldDoors:       {"doors"},
+	FieldEndDate:     {"end_date"},
+	FieldGenres:      {"genres"},
+	FieldSupport:     {"support"},
+	FieldImageURL:    {"image_url"},
+	FieldTicketURL:   {"ticket_url"},
+}
+
+// columnValues converts the value of a field, as returned by Event.FieldValue, into the values of its columns.
+func columnValues(field string, value interface{}) []interface{} {
+	switch v := value.(type) {
+	case *PriceRange:
+		if v == nil {
+			return []interface{}{nil, nil, nil}
+		}
+		return []interface{}{v.Min, v.Max, v.Currency}
+	case []string:
+		return []interface{}{marshalList(v)}
+	case EventStatus:
+		return []interface{}{string(v.OrScheduled())}
+	case time.Time:
+		if v.IsZero() && field != FieldDate {
+			return []interface{}{nil}
+		}
+		return []interface{}{v}
+	default:
+		return []interface{}{value}
+	}
+}
+
+// marshalList stores lists as JSON arrays, empty lists as empty string.
+func marshalList(values []string) string {
+	if len(values) == 0 {
+		return ""
 	}
+	b, _ := json.Marshal(values)
+	return string(b)
+}
 
-	updateQuery := fmt.Sprintf("UPDATE events SET %s = ? WHERE id = ?", fieldName)
+func unmarshalList(stored string) ([]string, error) {
+	if stored == "" {
+		return nil, nil
+	}
+	var values []string
+	if err := json.Unmarshal([]byte(stored), &values); err != nil {
+		return nil, fmt.Errorf("could not parse list %q: %v", stored, err)
+	}
+	return values, nil
+}
+
+func (store *Store) UpdateEvent(id int64, fieldName string, value interface{}) error {
+	updateQuery, err := updateEventQuery(fieldName)
 
-	err := store.inTransaction(updateQuery, func(stmt *sql.Stmt) (sql.Result, error) {
-		return stmt.Exec(value, id)
+	if err != nil {
+		return err
+	}
+
+	return store.inTransaction(updateQuery, func(stmt *sql.Stmt) (sql.Result, error) {
+		return stmt.Exec(append(columnValues(fieldName, value), id)...)
 	}, func(err error) error {
 		return fmt.Errorf("failed to update %q in event %d to %q because of: %s", fieldName, id, value, err)
 	})
+}
 
-	if err != nil {
-		panic(err)
+// updateEventQuery returns the query setting the columns of a field, the values are followed by the event ID.
+func updateEventQuery(fieldName string) (string, error) {
+	columns, exists := updatableColumns[fieldName]
+
+	if !exists {
+		return "", fmt.Errorf("unknown column provided for update: %q", fieldName)
+	}
+
+	var assignments []string
+	for _, column := range columns {
+		assignments = append(assignments, column+" = ?")
 	}
+
+	return fmt.Sprintf("UPDATE events SET %s WHERE id = ?", strings.Join(assignments, ", ")), nil
 }
 
-func (store *Store) LogUpdate(eventId int64, fieldName string, oldValue interface{}, newValue interface{}) {
-	err := store.inTransaction(`INSERT INTO updates (event_id, field, old, new) VALUES (?, ?, ?, ?)`, func(stmt *sql.Stmt) (sql.Result, error) {
+func (store *Store) LogUpdate(eventId int64, fieldName string, oldValue interface{}, newValue interface{}) error {
+	oldValue, newValue = formatFieldValue(oldValue), formatFieldValue(newValue)
+
+	return store.inTransaction(insertUpdateQuery, func(stmt *sql.Stmt) (sql.Result, error) {
 		return stmt.Exec(eventId, fieldName, oldValue, newValue)
 	}, func(err error) error {
-		return fmt.Errorf("failed to update %q in event %d, oldValue=%s, newValue=%s", fieldName, eventId, oldValue, newValue)
+		return fmt.Errorf("failed to log update of %q in event %d, oldValue=%s, newValue=%s: %v", fieldName, eventId, oldValue, newValue, err)
 	})
-
-	if err != nil {
-		panic(err)
-	}
 }
 
-func (store *Store) LogError(cr Crawler, errToLog error) {
-	err := store.inTransaction(`INSERT INTO errors (crawler, msg) VALUES (?, ?)`, func(stmt *sql.Stmt) (sql.Result, error) {
+func (store *Store) LogError(cr Crawler, errToLog error) error {
+	return store.inTransaction(insertErrorQuery, func(stmt *sql.Stmt) (sql.Result, error) {
 		return stmt.Exec(cr.Name(), errToLog.Error())
 	}, func(err error) error {
-		return fmt.Errorf("failed to store error %q for %q", err, cr.Name())
+		return fmt.Errorf("failed to store error %q for %q: %v", errToLog, cr.Name(), err)
 	})
+}
+
+// ErrEventNotFound is returned when looking up an event which does not exist.
+var ErrEventNotFound = errors.New("event not found")
+
+// FindEvent returns the event with the given public ID, including removed events and duplicates.
+func (store *Store) FindEvent(publicID string) (Event, error) {
+	rows, err := store.db.Query(`SELECT `+eventColumns+`
+		FROM events
+		JOIN venues ON venues.shortname = events.venue
+		WHERE events.public_id = ?`, publicID)
+
+	if err != nil {
+		return Event{}, fmt.Errorf("querying event %q failed: %v", publicID, err)
+	}
+	defer rows.Close()
+
+	events, err := store.withSourceVenues(mapRowsToEvents(rows))
 
 	if err != nil {
-		panic(err)
+		return Event{}, err
 	}
+
+	if len(events) == 0 {
+		return Event{}, ErrEventNotFound
+	}
+
+	return events[0], nil
 }
 
-func (store *Store) UpdateValue(key string, newValue string) {
-	err := store.inTransaction("INSERT OR REPLACE INTO keyvalue (key, value) VALUES (?, ?)", func(stmt *sql.Stmt) (sql.Result, error) {
-		return stmt.Exec(key, newValue)
-	}, func(err error) error {
-		return fmt.Errorf("failed to set value of %q to %q", key, newValue)
-	})
+// FindCalendarEvents returns the upcoming events of a venue, or of all venues if venue is empty, including removed
+// events so calendars learn about their cancellation. Duplicates are only included in the events of their venue.
+func (store *Store) FindCalendarEvents(venue string) ([]Event, error) {
+	condition, args := `events.canonical_id IS NULL`, []interface{}{store.Now()}
+
+	if venue != "" {
+		condition = `events.venue = ?`
+		args = append(args, venue)
+	}
+
+	rows, err := store.db.Query(`SELECT `+eventColumns+`
+		FROM events
+		JOIN venues ON venues.shortname = events.venue
+		WHERE `+store.db.dialect.date("events.date")+` >= `+store.db.dialect.date("?")+` AND `+condition+`
+		ORDER BY events.date, events.id`, args...)
 
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("querying calendar events failed: %v", err)
 	}
+	defer rows.Close()
+
+	return store.withSourceVenues(mapRowsToEvents(rows))
 }
 
-func (store *Store) ReadValue(key string) string {
-	rows, err := store.db.Query("SELECT value FROM keyvalue WHERE key=(?)", key)
+// FindRevisions counts the updates logged per event, keyed by event ID. Events which never changed are left out.
+func (store *Store) FindRevisions() (map[int64]Revision, error) {
+	rows, err := store.db.Query(`SELECT event_id, COUNT(*), ` + store.db.dialect.unixTime("MAX(datetime)") + `
+		FROM updates
+		GROUP BY event_id`)
+
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("querying revisions failed: %v", err)
 	}
 	defer rows.Close()
 
-	var value string
+	revisions := make(map[int64]Revision)
+
+	for rows.Next() {
+		var id, lastModified int64
+		var revision Revision
+
+		if err := rows.Scan(&id, &revision.Sequence, &lastModified); err != nil {
+			return nil, err
+		}
+
+		revision.LastModified = time.Unix(lastModified, 0)
+		revisions[id] = revision
+	}
+
+	return revisions, rows.Err()
+}
+
+// updateColumns are the columns read by mapRowsToUpdates, followed by the columns of the event.
+const updateColumns = `
+	updates.id,
+	updates.datetime,
+	updates.field,
+	updates.old,
+	updates.new,` + eventColumns
+
+// FindEventUpdates returns the updates logged for an event, oldest first.
+func (store *Store) FindEventUpdates(eventID int64) ([]EventUpdate, error) {
+	rows, err := store.db.Query(`SELECT `+updateColumns+`
+		FROM updates
+		JOIN events ON events.id = updates.event_id
+		JOIN venues ON venues.shortname = events.venue
+		WHERE updates.event_id = ?
+		ORDER BY updates.id`, eventID)
+
+	if err != nil {
+		return nil, fmt.Errorf("querying updates of event %d failed: %v", eventID, err)
+	}
+	defer rows.Close()
+
+	return mapRowsToUpdates(rows)
+}
+
+// FindRecentUpdates returns the updates matching the filter, latest first.
+func (store *Store) FindRecentUpdates(filter UpdateFilter) ([]EventUpdate, error) {
+	d := store.db.dialect
+	conditions := []string{d.dateTime(`updates.datetime`) + ` >= ` + d.dateTime(`?`)}
+	args := []interface{}{filter.From.UTC()}
+
+	if !filter.To.IsZero() {
+		conditions = append(conditions, d.dateTime(`updates.datetime`)+` < `+d.dateTime(`?`))
+		args = append(args, filter.To.UTC())
+	}
+
+	if len(filter.Venues) > 0 {
+		conditions = append(conditions, `events.venue IN (`+placeholders(len(filter.Venues))+`)`)
+		for _, venue := range filter.Venues {
+			args = append(args, venue)
+		}
+	}
+
+	if len(filter.Fields) > 0 {
+		conditions = append(conditions, `updates.field IN (`+placeholders(len(filter.Fields))+`)`)
+		for _, field := range filter.Fields {
+			args = append(args, field)
+		}
+	}
+
+	query := `SELECT ` + updateColumns + `
+		FROM updates
+		JOIN events ON events.id = updates.event_id
+		JOIN venues ON venues.shortname = events.venue
+		WHERE ` + strings.Join(conditions, ` AND `) + `
+		ORDER BY updates.datetime DESC, updates.id DESC`
+
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := store.db.Query(query, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("querying recent updates failed: %v", err)
+	}
+	defer rows.Close()
+
+	return mapRowsToUpdates(rows)
+}
+
+// loggedTimeLayout is the layout of the times written to the updates log, regardless of the database.
+const loggedTimeLayout = time.RFC3339
+
+// ParseLoggedTime parses a time written to the updates log, e.g. the old value of a date change.
+func ParseLoggedTime(value string) (time.Time, error) {
+	return time.Parse(loggedTimeLayout, value)
+}
+
+func mapRowsToUpdates(rows *sql.Rows) ([]EventUpdate, error) {
+	var updates []EventUpdate
+
+	for rows.Next() {
+		var update EventUpdate
+		ev, err := scanEvent(rows, &update.ID, &update.DateTime, &update.Field, &update.Old, &update.New)
 
-	if rows.Next() {
-		err = rows.Scan(&value)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+
+		update.Event = ev
+		updates = append(updates, update)
 	}
 
-	if rows.Next() {
-		panic(fmt.Sprintf("Lookup of key %q in key value table returned more than one row", key))
+	return updates, rows.Err()
+}
+
+// SetMissingCrawls records how many consecutive crawls an event was missing from.
+func (store *Store) SetMissingCrawls(id int64, missingCrawls int) error {
+	return store.inTransaction(setMissingCrawlsQuery, func(stmt *sql.Stmt) (sql.Result, error) {
+		return stmt.Exec(missingCrawls, id)
+	}, func(err error) error {
+		return fmt.Errorf("failed to set missing crawls of event %d: %v", id, err)
+	})
+}
+
+// MarkEventRemoved hides an event which vanished from the listing of its venue.
+func (store *Store) MarkEventRemoved(ev Event) error {
+	return store.inTransaction(markEventRemovedQuery, func(stmt *sql.Stmt) (sql.Result, error) {
+		return stmt.Exec(ev.MissingCrawls, store.Now(), ev.RemovalReason, ev.ID)
+	}, func(err error) error {
+		return fmt.Errorf("failed to mark event %d as removed: %v", ev.ID, err)
+	})
+}
+
+// RestoreEvent undoes MarkEventRemoved and SetMissingCrawls for an event found again.
+func (store *Store) RestoreEvent(id int64) error {
+	return store.inTransaction(restoreEventQuery, func(stmt *sql.Stmt) (sql.Result, error) {
+		return stmt.Exec(id)
+	}, func(err error) error {
+		return fmt.Errorf("failed to restore event %d: %v", id, err)
+	})
+}
+
+func (store *Store) UpdateValue(key string, newValue string) error {
+	return store.inTransaction(store.db.dialect.upsert("keyvalue", "key", "key", "value"), func(stmt *sql.Stmt) (sql.Result, error) {
+		return stmt.Exec(key, newValue)
+	}, func(err error) error {
+		return fmt.Errorf("failed to set value of %q to %q: %v", key, newValue, err)
+	})
+}
+
+// ReadValue returns the value of a key, or an empty string if it was never set.
+func (store *Store) ReadValue(key string) (string, error) {
+	var value string
+	err := store.db.QueryRow("SELECT value FROM keyvalue WHERE key=(?)", key).Scan(&value)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("reading value of %q failed: %v", key, err)
 	}
 
-	return value
+	return value, nil
+}
+
+// ReadCrawlTimes returns the values of LastCrawlTimeKey and of the LastVenueCrawlTimeKey of each venue crawled so far,
+// keyed by their keys.
+func (store *Store) ReadCrawlTimes() (map[string]string, error) {
+	rows, err := store.db.Query(`SELECT key, value FROM keyvalue WHERE key = ? OR key `+store.db.dialect.like()+` ? ESCAPE '\'`,
+		LastCrawlTimeKey, likePrefix(LastVenueCrawlTimeKey("")))
+
+	if err != nil {
+		return nil, fmt.Errorf("reading crawl times failed: %v", err)
+	}
+	defer rows.Close()
+
+	times := make(map[string]string)
+
+	for rows.Next() {
+		var key, value string
+
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("reading crawl times failed: %v", err)
+		}
+
+		times[key] = value
+	}
+
+	return times, rows.Err()
 }
 
 func (store *Store) inTransaction(query string, exec func(stmt *sql.Stmt) (sql.Result, error), createError func(err error) error) error {
@@ -233,7 +774,8 @@ func (store *Store) inTransaction(query string, exec func(stmt *sql.Stmt) (sql.R
 
 	stmt, err := tx.Prepare(query)
 	if err != nil {
-		return err
+		tx.Rollback()
+		return createError(err)
 	}
 
 	defer stmt.Close()
@@ -256,6 +798,43 @@ func (store *Store) inTransaction(query string, exec func(stmt *sql.Stmt) (sql.R
 	return nil
 }
 
+// FindEventDetails returns the details read from the detail page at url during an earlier crawl.
+func (store *Store) FindEventDetails(url string) (CachedDetails, bool, error) {
+	cached := CachedDetails{URL: url}
+	var details string
+
+	row := store.db.QueryRow("SELECT details, etag, last_modified, fetched FROM event_details WHERE url = ?", url)
+	err := row.Scan(&details, &cached.Validators.ETag, &cached.Validators.LastModified, &cached.Fetched)
+
+	if err == sql.ErrNoRows {
+		return CachedDetails{}, false, nil
+	} else if err != nil {
+		return CachedDetails{}, false, fmt.Errorf("querying details of %q failed: %v", url, err)
+	}
+
+	if err := json.Unmarshal([]byte(details), &cached.Details); err != nil {
+		return CachedDetails{}, false, fmt.Errorf("could not parse cached details of %q: %v", url, err)
+	}
+
+	return cached, true, nil
+}
+
+func (store *Store) SaveEventDetails(cached CachedDetails) error {
+	details, err := json.Marshal(cached.Details)
+
+	if err != nil {
+		return err
+	}
+
+	query := store.db.dialect.upsert("event_details", "url", "url", "details", "etag", "last_modified", "fetched")
+
+	return store.inTransaction(query, func(stmt *sql.Stmt) (sql.Result, error) {
+		return stmt.Exec(cached.URL, string(details), cached.Validators.ETag, cached.Validators.LastModified, cached.Fetched)
+	}, func(err error) error {
+		return fmt.Errorf("failed to cache details of %q: %v", cached.URL, err)
+	})
+}
+
 func (store *Store) GetCurrentFestivals() ([]Festival, error) {
 	festivals := make([]Festival, 0)
 
@@ -265,6 +844,8 @@ func (store *Store) GetCurrentFestivals() ([]Festival, error) {
 		return festivals, fmt.Errorf("error when getting festivals: %v", err)
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
 		var festival Festival
 		err := rows.Scan(&festival.Id, &festival.Url, &festival.Location, &festival.Title, &festival.DateStart, &festival.DateEnd)
@@ -273,15 +854,20 @@ func (store *Store) GetCurrentFestivals() ([]Festival, error) {
 			return festivals, fmt.Errorf("error when getting festivals: %v", err)
 		}
 
+		festivals = append(festivals, festival)
+	}
+
+	// the opening times are read once the festivals are, a connection can only run one query at a time
+	rows.Close()
+
+	for i, festival := range festivals {
 		openingTimes, err := store.getOpeningTimes(festival.Id)
 
 		if err != nil {
 			return festivals, fmt.Errorf("could not get opening times for festival %q: %v", festival.Title, err)
 		}
 
-		festival.OpeningTimes = openingTimes
-
-		festivals = append(festivals, festival)
+		festivals[i].OpeningTimes = openingTimes
 	}
 
 	return festivals, nil
@@ -297,6 +883,7 @@ func (store *Store) getOpeningTimes(venueId int64) ([]OpeningTime, error) {
 	if err != nil {
 		return openingTimes, fmt.Errorf("error when getting opening times: %v", err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var openingTime OpeningTime
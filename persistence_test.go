@@ -0,0 +1,318 @@
+package wasgeit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSaveAndUpdateEvent(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+
+	venue, err := st.FindVenue("dachstock")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2019, time.June, 20, 20, 0, 0, 0, location)
+	ev := Event{
+		Title:       "Band",
+		DateTime:    date,
+		URL:         "http://www.dachstock.ch/events/1",
+		Venue:       venue,
+		Description: "Rock from Bern",
+		Price:       &PriceRange{Min: 20, Max: 25, Currency: "CHF"},
+		EndDateTime: date.Add(3 * time.Hour),
+		Genres:      []string{"Rock", "Indie"},
+	}
+
+	if err := st.SaveEvent(ev); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := testEvents(t, st, "dachstock")
+
+	if len(saved) != 1 {
+		t.Fatalf("expected one event, got %d", len(saved))
+	}
+
+	if hasDiff, update := diff(ev, saved[0]); hasDiff {
+		t.Errorf("saved event differs in %v: %+v", update.ChangedFields, saved[0])
+	}
+
+	if saved[0].Status != StatusScheduled || !saved[0].Doors.IsZero() {
+		t.Errorf("expected defaults for unknown fields, got %+v", saved[0])
+	}
+
+	changed := saved[0]
+	changed.Status = StatusSoldOut
+	changed.Price = &PriceRange{Min: 30, Max: 30, Currency: "CHF"}
+	changed.Description = ""
+
+	hasDiff, update := diff(changed, saved[0])
+
+	if !hasDiff || len(update.ChangedFields) != 2 {
+		t.Fatalf("expected status and price to change, got %v", update.ChangedFields)
+	}
+
+	for _, field := range update.ChangedFields {
+		oldValue, newValue := update.Values(field)
+		if err := st.UpdateEvent(saved[0].ID, field, newValue); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.LogUpdate(saved[0].ID, field, oldValue, newValue); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	updated := testEvents(t, st, "dachstock")[0]
+
+	if updated.Status != StatusSoldOut || updated.Price.Min != 30 || updated.Description != "Rock from Bern" {
+		t.Errorf("event was not updated as expected: %+v", updated)
+	}
+}
+
+func TestRemovedEventsAreHidden(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+	st.Clock = FixedClock(fixtureTime)
+
+	venue := testVenue(t, st, "kairo")
+
+	for _, url := range []string{"/1", "/2"} {
+		ev := Event{Title: url, URL: url, DateTime: fixtureTime.Add(24 * time.Hour), Venue: venue}
+		if err := st.SaveEvent(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ev := testEvents(t, st, "kairo")[0]
+	ev.MissingCrawls, ev.RemovalReason = 3, "gone"
+
+	if err := st.MarkEventRemoved(ev); err != nil {
+		t.Fatal(err)
+	}
+
+	if upcoming := testEventsYetToHappen(t, st); len(upcoming) != 1 || upcoming[0].ID == ev.ID {
+		t.Errorf("expected removed event to be hidden, got %v", upcoming)
+	}
+
+	if err := st.RestoreEvent(ev.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if upcoming := testEventsYetToHappen(t, st); len(upcoming) != 2 {
+		t.Errorf("expected restored event to be listed again, got %v", upcoming)
+	}
+}
+
+func TestLinkDuplicates(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+	st.Clock = FixedClock(fixtureTime)
+
+	date := fixtureTime.Add(24 * time.Hour)
+	events := []Event{
+		{Title: "Band", URL: "/roessli/1", DateTime: date, Venue: testVenue(t, st, "roessli")},
+		{Title: "BAND!", URL: "/sous-le-pont/1", DateTime: date.Add(time.Hour), Venue: testVenue(t, st, "sous-le-pont")},
+		{Title: "Band", URL: "/dachstock/1", DateTime: date, Venue: testVenue(t, st, "dachstock")},
+		{Title: "Band", URL: "/roessli/2", DateTime: date.Add(2 * time.Hour), Venue: testVenue(t, st, "roessli")},
+	}
+
+	for _, ev := range events {
+		if err := st.SaveEvent(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	upcoming, err := st.FindUpcomingEvents()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clusters := FindDuplicates(upcoming)
+
+	if len(clusters) != 1 || len(clusters[0]) != 2 {
+		t.Fatalf("expected the shows at roessli and sous-le-pont to be clustered, got %v", clusters)
+	}
+
+	if err := st.LinkDuplicates(clusters); err != nil {
+		t.Fatal(err)
+	}
+
+	agenda := testEventsYetToHappen(t, st)
+
+	if len(agenda) != 3 {
+		t.Fatalf("expected the duplicate to be hidden, got %v", agenda)
+	}
+
+	for _, ev := range agenda {
+		if ev.ID == clusters[0][0].ID {
+			if len(ev.SourceVenues) != 1 || ev.SourceVenues[0].ShortName != clusters[0][1].Venue.ShortName {
+				t.Errorf("expected the venue of the duplicate, got %v", ev.SourceVenues)
+			}
+		} else if len(ev.SourceVenues) != 0 {
+			t.Errorf("expected no other venues for %v, got %v", ev, ev.SourceVenues)
+		}
+	}
+}
+
+func TestFindUpdates(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+
+	for _, venue := range []string{"kairo", "dachstock"} {
+		ev := Event{Title: venue, URL: "/" + venue, DateTime: fixtureTime, Venue: testVenue(t, st, venue)}
+		if err := st.SaveEvent(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kairo, dachstock := testEvents(t, st, "kairo")[0], testEvents(t, st, "dachstock")[0]
+	rescheduled := fixtureTime.Add(24 * time.Hour)
+
+	if err := st.LogUpdate(kairo.ID, FieldDate, kairo.DateTime, rescheduled); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.LogUpdate(kairo.ID, FieldStatus, StatusScheduled, StatusSoldOut); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.LogUpdate(dachstock.ID, FieldTitle, "dachstock", "Dachstock"); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := st.FindEventUpdates(kairo.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 2 || history[0].Field != FieldDate || history[1].New != string(StatusSoldOut) {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	if history[0].Event.ID != kairo.ID || history[0].Event.Venue.ShortName != "kairo" {
+		t.Errorf("expected the event to be joined, got %+v", history[0].Event)
+	}
+
+	recent, err := st.FindRecentUpdates(UpdateFilter{From: time.Now().Add(-time.Hour), Venues: []string{"dachstock"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recent) != 1 || recent[0].Event.ID != dachstock.ID {
+		t.Errorf("expected the update of dachstock, got %+v", recent)
+	}
+
+	if recent, err = st.FindRecentUpdates(UpdateFilter{From: time.Now().Add(-time.Hour), Limit: 2}); err != nil || len(recent) != 2 {
+		t.Errorf("expected two updates, got %+v (%v)", recent, err)
+	}
+
+	if recent, err = st.FindRecentUpdates(UpdateFilter{From: time.Now().Add(time.Hour)}); err != nil || len(recent) != 0 {
+		t.Errorf("expected no updates in the future, got %+v (%v)", recent, err)
+	}
+
+	if err := st.UpdateEvent(kairo.ID, FieldTitle, "Kairo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if found, err := st.FindEvent(kairo.PublicID); err != nil || found.ID != kairo.ID || found.Title != "Kairo" {
+		t.Errorf("expected the public ID to survive the update, got %+v (%v)", found, err)
+	}
+
+	if _, err := st.FindEvent("unknown"); err != ErrEventNotFound {
+		t.Errorf("expected ErrEventNotFound, got %v", err)
+	}
+}
+
+func TestFindAgenda(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+	st.Clock = FixedClock(fixtureTime)
+
+	day := 24 * time.Hour
+	events := []Event{
+		{Title: "Yesterday", URL: "/0", DateTime: fixtureTime.Add(-day), Venue: testVenue(t, st, "kairo")},
+		{Title: "Rock 50% off", URL: "/1", DateTime: fixtureTime.Add(day), Venue: testVenue(t, st, "kairo")},
+		{Title: "Jazz", URL: "/2", DateTime: fixtureTime.Add(day), Venue: testVenue(t, st, "dachstock"), Description: "Rock-Jazz"},
+		{Title: "Folk", URL: "/3", DateTime: fixtureTime.Add(2 * day), Venue: testVenue(t, st, "roessli")},
+		{Title: "Folk", URL: "/4", DateTime: fixtureTime.Add(2 * day), Venue: testVenue(t, st, "sous-le-pont")},
+		{Title: "Later", URL: "/5", DateTime: fixtureTime.Add(10 * day), Venue: testVenue(t, st, "dachstock")},
+	}
+
+	for _, ev := range events {
+		if err := st.SaveEvent(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	upcoming, err := st.FindUpcomingEvents()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.LinkDuplicates(FindDuplicates(upcoming)); err != nil {
+		t.Fatal(err)
+	}
+
+	titles := func(q AgendaQuery) []string {
+		t.Helper()
+
+		if err := q.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		var titles []string
+		for {
+			page, err := st.FindAgenda(q)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, ev := range page.Events {
+				titles = append(titles, ev.Title)
+			}
+
+			if page.NextCursor == "" {
+				return titles
+			}
+			q.Cursor = page.NextCursor
+		}
+	}
+
+	for name, test := range map[string]struct {
+		query    AgendaQuery
+		expected []string
+	}{
+		"upcoming":  {AgendaQuery{}, []string{"Rock 50% off", "Jazz", "Folk", "Later"}},
+		"paged":     {AgendaQuery{Limit: 1}, []string{"Rock 50% off", "Jazz", "Folk", "Later"}},
+		"reversed":  {AgendaQuery{Limit: 3, Sort: SortByDateDescending}, []string{"Later", "Folk", "Jazz", "Rock 50% off"}},
+		"range":     {AgendaQuery{From: fixtureTime.Add(-2 * day), To: fixtureTime.Add(2 * day)}, []string{"Yesterday", "Rock 50% off", "Jazz"}},
+		"venues":    {AgendaQuery{Venues: []string{"dachstock", "sous-le-pont"}}, []string{"Jazz", "Folk", "Later"}},
+		"text":      {AgendaQuery{Text: "rock"}, []string{"Rock 50% off", "Jazz"}},
+		"words":     {AgendaQuery{Text: "rock 50%"}, []string{"Rock 50% off"}},
+		"wildcards": {AgendaQuery{Text: "_"}, nil},
+	} {
+		if actual := titles(test.query); !reflect.DeepEqual(test.expected, actual) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, actual)
+		}
+	}
+
+	for _, invalid := range []AgendaQuery{
+		{From: fixtureTime, To: fixtureTime},
+		{Limit: MaxAgendaLimit + 1},
+		{Sort: "title"},
+		{Cursor: "nonsense"},
+		{Cursor: AgendaQuery{}.encodeCursor(agendaSortKey{column: "events.date"}, events[1]), Sort: SortByCreated},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", invalid)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package wasgeit
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultCurrency is assumed for prices without currency, all venues are in Switzerland.
+const defaultCurrency = "CHF"
+
+// PriceRange is the price of an event, Min and Max are equal if there is a single price. Free events cost 0.
+type PriceRange struct {
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Currency string  `json:"currency"`
+}
+
+func (price PriceRange) String() string {
+	if price.Min == price.Max {
+		return fmt.Sprintf("%s %s", price.Currency, formatAmount(price.Min))
+	}
+	return fmt.Sprintf("%s %s-%s", price.Currency, formatAmount(price.Min), formatAmount(price.Max))
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+var (
+	amountPattern = regexp.MustCompile(`\d+(?:[.,]\d{1,2})?`)
+	freePattern   = regexp.MustCompile(`(?i)\b(frei|free|gratis|kostenlos|libre)\b`)
+	currencies    = []struct {
+		pattern  *regexp.Regexp
+		currency string
+	}{
+		{regexp.MustCompile(`(?i)\b(chf|sfr|fr)\b`), "CHF"},
+		{regexp.MustCompile(`(?i)€|\beur\b|\beuro\b`), "EUR"},
+	}
+)
+
+// ParsePrice reads a price as found on the sites, e.g. "CHF 25.–", "VVK 20 / AK 25" or "Eintritt frei". The lowest
+// and highest amount mentioned make up the range.
+func ParsePrice(s string) (*PriceRange, error) {
+	s = strings.TrimSpace(s)
+
+	if s == "" {
+		return nil, nil
+	}
+
+	price := PriceRange{Currency: defaultCurrency}
+
+	for _, c := range currencies {
+		if c.pattern.MatchString(s) {
+			price.Currency = c.currency
+			break
+		}
+	}
+
+	amounts := amountPattern.FindAllString(s, -1)
+
+	if len(amounts) == 0 {
+		if freePattern.MatchString(s) {
+			return &price, nil
+		}
+		return nil, fmt.Errorf("no price found in %q", s)
+	}
+
+	for i, amount := range amounts {
+		value, err := strconv.ParseFloat(strings.Replace(amount, ",", ".", 1), 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("could not parse price %q: %v", s, err)
+		}
+
+		if i == 0 || value < price.Min {
+			price.Min = value
+		}
+		if i == 0 || value > price.Max {
+			price.Max = value
+		}
+	}
+
+	return &price, nil
+}
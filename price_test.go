@@ -0,0 +1,34 @@
+package wasgeit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		price    string
+		expected *PriceRange
+	}{
+		{"CHF 25.–", &PriceRange{Min: 25, Max: 25, Currency: "CHF"}},
+		{"VVK 20.- / AK 25.-", &PriceRange{Min: 20, Max: 25, Currency: "CHF"}},
+		{"Fr. 12,50", &PriceRange{Min: 12.5, Max: 12.5, Currency: "CHF"}},
+		{"€ 15", &PriceRange{Min: 15, Max: 15, Currency: "EUR"}},
+		{"Eintritt frei", &PriceRange{Min: 0, Max: 0, Currency: "CHF"}},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		actual, err := ParsePrice(test.price)
+
+		if err != nil {
+			t.Errorf("parsing %q failed: %v", test.price, err)
+		} else if !reflect.DeepEqual(test.expected, actual) {
+			t.Errorf("expected %q to be parsed as %v, got %v", test.price, test.expected, actual)
+		}
+	}
+
+	if _, err := ParsePrice("Kollekte"); err == nil {
+		t.Error("expected an error for a price without amount")
+	}
+}
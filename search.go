@@ -0,0 +1,205 @@
+package wasgeit
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrSearchUnavailable is returned by Store.Search if the database has no search index, either because SQLite was
+// built without FTS5 (build with -tags fts5) or on PostgreSQL. Store.Migrate sets up the index where it is supported.
+var ErrSearchUnavailable = errors.New("search is not available")
+
+// SearchResult is an event found by Store.Search. The snippet holds the best matching part of the event, HTML escaped
+// and with the matches enclosed in <mark>.
+type SearchResult struct {
+	Event   Event
+	Snippet string
+	Rank    float64
+}
+
+const (
+	searchMatchStart = "\x02"
+	searchMatchEnd   = "\x03"
+	searchEllipsis   = "…"
+	// searchSnippetTokens is the number of tokens of a snippet
+	searchSnippetTokens = 12
+)
+
+// searchWeights weigh the columns title, description and support of events_search for ranking.
+const searchWeights = "10.0, 1.0, 5.0"
+
+// unfoldedUmlauts maps umlauts spelled out by Normalize to the letter the tokenizer of the index turns them into.
+var unfoldedUmlauts = strings.NewReplacer("ae", "a", "oe", "o", "ue", "u")
+
+// searchExpression turns a free text into an FTS5 query requiring all of its words. A word matches words starting
+// with it, words spelled out without umlauts also match words with umlauts, e.g. "bierhuebeli" finds "Bierhübeli".
+func searchExpression(text string) string {
+	var terms []string
+
+	for _, word := range strings.Fields(Normalize(text)) {
+		term := `"` + word + `"*`
+
+		if unfolded := unfoldedUmlauts.Replace(word); unfolded != word {
+			term = `(` + term + ` OR "` + unfolded + `"*)`
+		}
+
+		terms = append(terms, term)
+	}
+
+	return strings.Join(terms, " AND ")
+}
+
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	return strings.NewReplacer(searchMatchStart, "<mark>", searchMatchEnd, "</mark>").Replace(escaped)
+}
+
+// HasSearchIndex tells whether the search index exists.
+func (store *Store) HasSearchIndex() (bool, error) {
+	return store.tableExists("events_search")
+}
+
+// CreateSearchIndex creates the search index along with the triggers keeping it in sync with the events, it is left
+// out if SQLite lacks FTS5 and on PostgreSQL. Existing events are not indexed, see RebuildSearchIndex.
+func (store *Store) CreateSearchIndex() error {
+	supported, err := store.db.dialect.searchSupported(store.db)
+
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		return ErrSearchUnavailable
+	}
+
+	script, err := readAsset("sql/create-search.sql")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = store.db.Exec(script)
+
+	return err
+}
+
+// ensureSearchIndex creates the search index and indexes the events stored so far unless the index exists. Databases
+// without support for the index are left as they are.
+func (store *Store) ensureSearchIndex() error {
+	exists, err := store.HasSearchIndex()
+
+	if err != nil || exists {
+		return err
+	}
+
+	indexed, err := store.RebuildSearchIndex()
+
+	if err == ErrSearchUnavailable {
+		log.Warn("The database does not support the search index, events cannot be searched")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to set up the search index: %v", err)
+	}
+
+	log.Infof("Set up the search index with %d events", indexed)
+	return nil
+}
+
+// RebuildSearchIndex creates the search index if needed and indexes all events, e.g. those stored before the index
+// existed.
+func (store *Store) RebuildSearchIndex() (int64, error) {
+	if err := store.CreateSearchIndex(); err != nil {
+		return 0, err
+	}
+
+	tx, err := store.db.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM events_search`); err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to clear search index: %v", err)
+	}
+
+	result, err := tx.Exec(`INSERT INTO events_search (rowid, title, description, support)
+		SELECT id, title, description, support FROM events`)
+
+	if err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to index events: %v", err)
+	}
+
+	indexed, _ := result.RowsAffected()
+
+	return indexed, tx.Commit()
+}
+
+// Search finds the upcoming events matching the text, the best matches first.
+func (store *Store) Search(text string, limit int) ([]SearchResult, error) {
+	expression := searchExpression(text)
+
+	if expression == "" {
+		return nil, nil
+	}
+
+	if exists, err := store.HasSearchIndex(); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrSearchUnavailable
+	}
+
+	rows, err := store.db.Query(`SELECT
+			snippet(events_search, -1, ?, ?, ?, ?),
+			bm25(events_search, `+searchWeights+`),`+eventColumns+`
+		FROM events_search
+		JOIN events ON events.id = events_search.rowid
+		JOIN venues ON venues.shortname = events.venue
+		WHERE events_search MATCH ? AND `+store.db.dialect.date("events.date")+` >= `+store.db.dialect.date("?")+` AND events.removed IS NULL
+			AND events.canonical_id IS NULL
+		ORDER BY bm25(events_search, `+searchWeights+`), events.date
+		LIMIT ?`,
+		searchMatchStart, searchMatchEnd, searchEllipsis, searchSnippetTokens, expression, store.Now(), limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("searching %q failed: %v", text, err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	var events []Event
+
+	for rows.Next() {
+		var result SearchResult
+		ev, err := scanEvent(rows, &result.Snippet, &result.Rank)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.Snippet = highlightSnippet(result.Snippet)
+		results = append(results, result)
+		events = append(events, ev)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	events, err = store.withSourceVenues(events, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, ev := range events {
+		results[i].Event = ev
+	}
+
+	return results, nil
+}
@@ -0,0 +1,176 @@
+//go:build fts5
+// +build fts5
+
+package wasgeit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearch(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+	st.Clock = FixedClock(fixtureTime)
+
+	// events stored before the index existed are indexed by RebuildSearchIndex
+	if _, err := st.db.Exec(`DROP TABLE events_search`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.db.Exec(`DROP TRIGGER events_search_insert`); err != nil {
+		t.Fatal(err)
+	}
+
+	date := fixtureTime.Add(24 * time.Hour)
+	venue := testVenue(t, st, "bierhuebeli")
+
+	if err := st.SaveEvent(Event{Title: "Züri West", URL: "/1", DateTime: date, Venue: venue}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.Search("west", 10); err != ErrSearchUnavailable {
+		t.Fatalf("expected search to be unavailable without index, got %v", err)
+	}
+
+	if indexed, err := st.RebuildSearchIndex(); err != nil || indexed != 1 {
+		t.Fatalf("expected one event to be indexed, got %d (%v)", indexed, err)
+	}
+
+	for _, ev := range []Event{
+		{Title: "Stiller Has", URL: "/2", DateTime: date, Venue: venue, Description: "Mit Gästen aus Zürich & <Bern>"},
+		{Title: "Café Tacvba", URL: "/3", DateTime: date, Venue: venue},
+		{Title: "Zueri West", URL: "/4", DateTime: fixtureTime.Add(-48 * time.Hour), Venue: venue},
+	} {
+		if err := st.SaveEvent(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for query, expected := range map[string][]string{
+		"zueri":    {"Züri West", "Stiller Has"},
+		"Zürich":   {"Stiller Has"},
+		"cafe":     {"Café Tacvba"},
+		"tacv":     {"Café Tacvba"},
+		"has west": nil,
+	} {
+		results, err := st.Search(query, 10)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var titles []string
+		for _, result := range results {
+			titles = append(titles, result.Event.Title)
+		}
+
+		if len(titles) != len(expected) || (len(titles) > 0 && titles[0] != expected[0]) {
+			t.Errorf("expected %v for %q, got %v", expected, query, titles)
+		}
+	}
+
+	ev := testEvents(t, st, "bierhuebeli")[1]
+	if err := st.UpdateEvent(ev.ID, FieldTitle, "Stiller Hase"); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := st.Search("hase", 10)
+
+	if err != nil || len(results) != 1 {
+		t.Fatalf("expected the updated title to be found, got %v (%v)", results, err)
+	}
+
+	results, err = st.Search("gaesten", 10)
+
+	if err != nil || len(results) != 1 {
+		t.Fatalf("expected the description to be found, got %v (%v)", results, err)
+	}
+
+	if expected := "Mit <mark>Gästen</mark> aus Zürich &amp; &lt;Bern&gt;"; results[0].Snippet != expected {
+		t.Errorf("expected snippet %q, got %q", expected, results[0].Snippet)
+	}
+}
+
+func TestMigrateSetsUpSearchIndex(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+	st.Clock = FixedClock(fixtureTime)
+
+	// a database migrated by a build without FTS5 lacks the index
+	for _, drop := range []string{`DROP TABLE events_search`, `DROP TRIGGER events_search_insert`,
+		`DROP TRIGGER events_search_update`, `DROP TRIGGER events_search_delete`} {
+		if _, err := st.db.Exec(drop); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	venue := testVenue(t, st, "bierhuebeli")
+
+	if err := st.SaveEvent(Event{Title: "Züri West", URL: "/1", DateTime: fixtureTime.Add(24 * time.Hour), Venue: venue}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if results, err := st.Search("west", 10); err != nil || len(results) != 1 {
+		t.Errorf("expected the stored event to be indexed, got %v (%v)", results, err)
+	}
+
+	if err := st.SaveEvent(Event{Title: "Stiller Has", URL: "/2", DateTime: fixtureTime.Add(24 * time.Hour), Venue: venue}); err != nil {
+		t.Fatal(err)
+	}
+
+	if results, err := st.Search("stiller", 10); err != nil || len(results) != 1 {
+		t.Errorf("expected new events to be indexed, got %v (%v)", results, err)
+	}
+}
+
+func TestMigrateDownKeepsSearchIndex(t *testing.T) {
+	st := newTestStore(t)
+	defer st.Close()
+	st.Clock = FixedClock(fixtureTime)
+
+	venue := testVenue(t, st, "bierhuebeli")
+	date := fixtureTime.Add(24 * time.Hour)
+
+	if err := st.SaveEvent(Event{Title: "Züri West", URL: "/1", DateTime: date, Venue: venue}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the events table is copied by the down scripts, the search index has to follow the events stored afterwards
+	if err := st.MigrateTo(4); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.db.Exec(`INSERT INTO events (title, date, url, venue) VALUES (?, ?, ?, ?)`, "Stiller Has", date, "/2", "bierhuebeli"); err != nil {
+		t.Fatal(err)
+	}
+
+	var indexed int
+
+	if err := st.db.QueryRow(`SELECT COUNT(*) FROM events_search WHERE events_search MATCH ?`, "stiller").Scan(&indexed); err != nil || indexed != 1 {
+		t.Errorf("expected the event to be indexed, got %d (%v)", indexed, err)
+	}
+
+	// below the indexed columns the index is dropped and set up again by Migrate
+	if err := st.MigrateTo(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := st.HasSearchIndex(); err != nil || exists {
+		t.Errorf("expected the search index to be dropped, got %t (%v)", exists, err)
+	}
+
+	if err := st.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{"west", "stiller"} {
+		if results, err := st.Search(query, 10); err != nil || len(results) != 1 {
+			t.Errorf("expected one event found by %q, got %v (%v)", query, results, err)
+		}
+	}
+}
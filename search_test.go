@@ -0,0 +1,15 @@
+package wasgeit
+
+import "testing"
+
+func TestSearchExpression(t *testing.T) {
+	for text, expected := range map[string]string{
+		"Bierhübeli":       `("bierhuebeli"* OR "bierhubeli"*)`,
+		"Café \"del\" Mar": `"cafe"* AND "del"* AND "mar"*`,
+		"  ":               "",
+	} {
+		if actual := searchExpression(text); actual != expected {
+			t.Errorf("expected %s for %q, got %s", expected, text, actual)
+		}
+	}
+}
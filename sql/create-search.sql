@@ -0,0 +1,15 @@
+-- requires SQLite with FTS5, see Store.CreateSearchIndex
+CREATE VIRTUAL TABLE IF NOT EXISTS events_search USING fts5(title, description, support, tokenize = 'unicode61 remove_diacritics 1');
+
+CREATE TRIGGER IF NOT EXISTS events_search_insert AFTER INSERT ON events BEGIN
+  INSERT INTO events_search (rowid, title, description, support) VALUES (new.id, new.title, new.description, new.support);
+END;
+
+CREATE TRIGGER IF NOT EXISTS events_search_update AFTER UPDATE OF title, description, support ON events BEGIN
+  DELETE FROM events_search WHERE rowid = old.id;
+  INSERT INTO events_search (rowid, title, description, support) VALUES (new.id, new.title, new.description, new.support);
+END;
+
+CREATE TRIGGER IF NOT EXISTS events_search_delete AFTER DELETE ON events BEGIN
+  DELETE FROM events_search WHERE rowid = old.id;
+END;
@@ -1,4 +1,9 @@
-drop table events;
-drop table venues;
-drop table updates;
-drop table errors;
\ No newline at end of file
+DROP TABLE IF EXISTS events_search;
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS opening_times;
+DROP TABLE IF EXISTS venues;
+DROP TABLE IF EXISTS updates;
+DROP TABLE IF EXISTS errors;
+DROP TABLE IF EXISTS keyvalue;
+DROP TABLE IF EXISTS event_details;
+DROP TABLE IF EXISTS schema_migrations;
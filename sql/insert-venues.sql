@@ -1,4 +1,3 @@
-BEGIN TRANSACTION;
 INSERT INTO `venues` (id,url,name,shortname) VALUES (1,'http://www.cafe-kairo.ch/kultur','Cafe Kairo','kairo'),
   (2,'http://www.dachstock.ch','Dachstock','dachstock'),
   (3,'http://www.turnhalle.ch','Turnhalle','turnhalle'),
@@ -19,4 +18,3 @@ INSERT INTO `venues` (id,url,name,shortname) VALUES (1,'http://www.cafe-kairo.ch
   (18,'http://mokka.ch/programm/','Mokka','mokka'),
   (19,'http://www.muehlehunziken.ch','Mühle Hunziken','muehle-hunziken'),
   (20,'https://gaskessel.ch','Gaskessel','gaskessel');
-COMMIT;
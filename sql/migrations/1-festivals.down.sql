@@ -0,0 +1,16 @@
+DROP TABLE opening_times;
+
+-- SQLite cannot drop columns, the table is copied instead. Festivals are kept as venues, events may refer to them
+CREATE TABLE venues_down
+(
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    url       TEXT,
+    name      TEXT UNIQUE,
+    shortname TEXT UNIQUE
+);
+INSERT INTO venues_down (id, url, name, shortname)
+SELECT id, url, name, shortname
+FROM venues;
+DROP TABLE venues;
+ALTER TABLE venues_down
+    RENAME TO venues;
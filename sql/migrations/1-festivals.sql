@@ -4,8 +4,11 @@ ALTER TABLE venues
     ADD COLUMN date_start DATE;
 ALTER TABLE venues
     ADD COLUMN date_end DATE;
+-- SQLite cannot add columns with a non-constant default
 ALTER TABLE venues
-    ADD COLUMN created DATETIME DEFAULT CURRENT_TIMESTAMP;
+    ADD COLUMN created DATETIME;
+UPDATE venues
+SET created = CURRENT_TIMESTAMP;
 ALTER TABLE venues
     ADD COLUMN placement TEXT DEFAULT 'agenda' NOT NULL CHECK (placement IN ('agenda', 'what-else'));
 
@@ -18,4 +21,4 @@ CREATE TABLE opening_times
     time_end   TEXT    NOT NULL,
     created    DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (venue_id) REFERENCES venues (id)
-);
\ No newline at end of file
+);
@@ -0,0 +1,8 @@
+CREATE TABLE event_details
+(
+    url           TEXT PRIMARY KEY,
+    details       TEXT     NOT NULL,
+    etag          TEXT     NOT NULL DEFAULT '',
+    last_modified TEXT     NOT NULL DEFAULT '',
+    fetched       DATETIME NOT NULL
+);
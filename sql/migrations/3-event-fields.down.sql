@@ -0,0 +1,17 @@
+-- SQLite cannot drop columns, the table is copied instead
+CREATE TABLE events_down
+(
+    id             INTEGER  PRIMARY KEY,
+    title          TEXT     NOT NULL,
+    date           DATETIME NOT NULL,
+    url            TEXT     NOT NULL,
+    venue          TEXT     NOT NULL,
+    created        DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO events_down (id, title, date, url, venue, created)
+SELECT id, title, date, url, venue, created
+FROM events;
+DROP TABLE events;
+ALTER TABLE events_down
+    RENAME TO events;
+CREATE UNIQUE INDEX events_uq_title_date ON events (title, date);
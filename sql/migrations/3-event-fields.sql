@@ -0,0 +1,22 @@
+ALTER TABLE events
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'cancelled', 'postponed', 'sold-out'));
+ALTER TABLE events
+    ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE events
+    ADD COLUMN price_min REAL;
+ALTER TABLE events
+    ADD COLUMN price_max REAL;
+ALTER TABLE events
+    ADD COLUMN currency TEXT;
+ALTER TABLE events
+    ADD COLUMN doors DATETIME;
+ALTER TABLE events
+    ADD COLUMN end_date DATETIME;
+ALTER TABLE events
+    ADD COLUMN genres TEXT NOT NULL DEFAULT '';
+ALTER TABLE events
+    ADD COLUMN support TEXT NOT NULL DEFAULT '';
+ALTER TABLE events
+    ADD COLUMN image_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE events
+    ADD COLUMN ticket_url TEXT NOT NULL DEFAULT '';
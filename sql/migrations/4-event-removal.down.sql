@@ -0,0 +1,28 @@
+-- SQLite cannot drop columns, the table is copied instead
+CREATE TABLE events_down
+(
+    id             INTEGER  PRIMARY KEY,
+    title          TEXT     NOT NULL,
+    date           DATETIME NOT NULL,
+    url            TEXT     NOT NULL,
+    venue          TEXT     NOT NULL,
+    created        DATETIME DEFAULT CURRENT_TIMESTAMP,
+    status         TEXT     NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'cancelled', 'postponed', 'sold-out')),
+    description    TEXT     NOT NULL DEFAULT '',
+    price_min      REAL,
+    price_max      REAL,
+    currency       TEXT,
+    doors          DATETIME,
+    end_date       DATETIME,
+    genres         TEXT     NOT NULL DEFAULT '',
+    support        TEXT     NOT NULL DEFAULT '',
+    image_url      TEXT     NOT NULL DEFAULT '',
+    ticket_url     TEXT     NOT NULL DEFAULT ''
+);
+INSERT INTO events_down (id, title, date, url, venue, created, status, description, price_min, price_max, currency, doors, end_date, genres, support, image_url, ticket_url)
+SELECT id, title, date, url, venue, created, status, description, price_min, price_max, currency, doors, end_date, genres, support, image_url, ticket_url
+FROM events;
+DROP TABLE events;
+ALTER TABLE events_down
+    RENAME TO events;
+CREATE UNIQUE INDEX events_uq_title_date ON events (title, date);
@@ -0,0 +1,6 @@
+ALTER TABLE events
+    ADD COLUMN missing_crawls INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE events
+    ADD COLUMN removed DATETIME;
+ALTER TABLE events
+    ADD COLUMN removal_reason TEXT NOT NULL DEFAULT '';
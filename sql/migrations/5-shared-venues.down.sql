@@ -0,0 +1,51 @@
+-- SQLite cannot drop columns, the tables are copied instead
+CREATE TABLE venues_down
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    url        TEXT,
+    name       TEXT UNIQUE,
+    shortname  TEXT UNIQUE,
+    location   TEXT,
+    date_start DATE,
+    date_end   DATE,
+    created    DATETIME,
+    placement  TEXT DEFAULT 'agenda' NOT NULL CHECK (placement IN ('agenda', 'what-else'))
+);
+INSERT INTO venues_down (id, url, name, shortname, location, date_start, date_end, created, placement)
+SELECT id, url, name, shortname, location, date_start, date_end, created, placement
+FROM venues;
+DROP TABLE venues;
+ALTER TABLE venues_down
+    RENAME TO venues;
+
+CREATE TABLE events_down
+(
+    id             INTEGER  PRIMARY KEY,
+    title          TEXT     NOT NULL,
+    date           DATETIME NOT NULL,
+    url            TEXT     NOT NULL,
+    venue          TEXT     NOT NULL,
+    created        DATETIME DEFAULT CURRENT_TIMESTAMP,
+    status         TEXT     NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'cancelled', 'postponed', 'sold-out')),
+    description    TEXT     NOT NULL DEFAULT '',
+    price_min      REAL,
+    price_max      REAL,
+    currency       TEXT,
+    doors          DATETIME,
+    end_date       DATETIME,
+    genres         TEXT     NOT NULL DEFAULT '',
+    support        TEXT     NOT NULL DEFAULT '',
+    image_url      TEXT     NOT NULL DEFAULT '',
+    ticket_url     TEXT     NOT NULL DEFAULT '',
+    missing_crawls INTEGER  NOT NULL DEFAULT 0,
+    removed        DATETIME,
+    removal_reason TEXT     NOT NULL DEFAULT ''
+);
+INSERT INTO events_down (id, title, date, url, venue, created, status, description, price_min, price_max, currency, doors, end_date, genres, support, image_url, ticket_url, missing_crawls, removed, removal_reason)
+SELECT id, title, date, url, venue, created, status, description, price_min, price_max, currency, doors, end_date, genres, support, image_url, ticket_url, missing_crawls, removed, removal_reason
+FROM events;
+DROP TABLE events;
+ALTER TABLE events_down
+    RENAME TO events;
+-- fails if several venues list a show with the same title and date
+CREATE UNIQUE INDEX events_uq_title_date ON events (title, date);
@@ -0,0 +1,12 @@
+ALTER TABLE venues
+    ADD COLUMN building TEXT NOT NULL DEFAULT '';
+UPDATE venues
+SET building = 'souslepont-roessli'
+WHERE shortname IN ('roessli', 'sous-le-pont');
+
+ALTER TABLE events
+    ADD COLUMN canonical_id INTEGER REFERENCES events (id);
+
+-- the same show may be listed by several venues
+DROP INDEX events_uq_title_date;
+CREATE UNIQUE INDEX events_uq_venue_title_date ON events (venue, title, date);
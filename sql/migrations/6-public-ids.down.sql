@@ -0,0 +1,32 @@
+-- SQLite cannot drop columns, the table is copied instead
+CREATE TABLE events_down
+(
+    id             INTEGER  PRIMARY KEY,
+    title          TEXT     NOT NULL,
+    date           DATETIME NOT NULL,
+    url            TEXT     NOT NULL,
+    venue          TEXT     NOT NULL,
+    created        DATETIME DEFAULT CURRENT_TIMESTAMP,
+    status         TEXT     NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'cancelled', 'postponed', 'sold-out')),
+    description    TEXT     NOT NULL DEFAULT '',
+    price_min      REAL,
+    price_max      REAL,
+    currency       TEXT,
+    doors          DATETIME,
+    end_date       DATETIME,
+    genres         TEXT     NOT NULL DEFAULT '',
+    support        TEXT     NOT NULL DEFAULT '',
+    image_url      TEXT     NOT NULL DEFAULT '',
+    ticket_url     TEXT     NOT NULL DEFAULT '',
+    missing_crawls INTEGER  NOT NULL DEFAULT 0,
+    removed        DATETIME,
+    removal_reason TEXT     NOT NULL DEFAULT '',
+    canonical_id   INTEGER  REFERENCES events (id)
+);
+INSERT INTO events_down (id, title, date, url, venue, created, status, description, price_min, price_max, currency, doors, end_date, genres, support, image_url, ticket_url, missing_crawls, removed, removal_reason, canonical_id)
+SELECT id, title, date, url, venue, created, status, description, price_min, price_max, currency, doors, end_date, genres, support, image_url, ticket_url, missing_crawls, removed, removal_reason, canonical_id
+FROM events;
+DROP TABLE events;
+ALTER TABLE events_down
+    RENAME TO events;
+CREATE UNIQUE INDEX events_uq_venue_title_date ON events (venue, title, date);
@@ -0,0 +1,6 @@
+ALTER TABLE events
+    ADD COLUMN public_id TEXT NOT NULL DEFAULT '';
+-- the identity of stored events is not known to SQL, new events get a hash of venue and identity
+UPDATE events
+SET public_id = venue || '-' || id;
+CREATE UNIQUE INDEX events_uq_public_id ON events (public_id);
@@ -0,0 +1,7 @@
+-- times are logged as RFC 3339 from now on, the ones logged so far are in the format of the database driver
+UPDATE updates
+SET old = substr(old, 1, 10) || 'T' || substr(old, 12)
+WHERE old LIKE '____-__-__ __:__:__%';
+UPDATE updates
+SET new = substr(new, 1, 10) || 'T' || substr(new, 12)
+WHERE new LIKE '____-__-__ __:__:__%';
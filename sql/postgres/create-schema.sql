@@ -0,0 +1,114 @@
+-- The schema of version 6 along with the venues, PostgreSQL databases start with it
+CREATE TABLE venues
+(
+    id         SERIAL PRIMARY KEY,
+    url        TEXT,
+    name       TEXT UNIQUE,
+    shortname  TEXT UNIQUE,
+    location   TEXT,
+    date_start DATE,
+    date_end   DATE,
+    created    TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    placement  TEXT        NOT NULL DEFAULT 'agenda' CHECK (placement IN ('agenda', 'what-else')),
+    building   TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE TABLE opening_times
+(
+    id         SERIAL PRIMARY KEY,
+    venue_id   INTEGER NOT NULL REFERENCES venues (id),
+    days       TEXT    NOT NULL,
+    time_start TEXT    NOT NULL,
+    time_end   TEXT    NOT NULL,
+    created    TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE events
+(
+    id             BIGSERIAL PRIMARY KEY,
+    public_id      TEXT             NOT NULL,
+    title          TEXT             NOT NULL,
+    date           TIMESTAMPTZ      NOT NULL,
+    url            TEXT             NOT NULL,
+    venue          TEXT             NOT NULL,
+    created        TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    status         TEXT             NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'cancelled', 'postponed', 'sold-out')),
+    description    TEXT             NOT NULL DEFAULT '',
+    price_min      DOUBLE PRECISION,
+    price_max      DOUBLE PRECISION,
+    currency       TEXT,
+    doors          TIMESTAMPTZ,
+    end_date       TIMESTAMPTZ,
+    genres         TEXT             NOT NULL DEFAULT '',
+    support        TEXT             NOT NULL DEFAULT '',
+    image_url      TEXT             NOT NULL DEFAULT '',
+    ticket_url     TEXT             NOT NULL DEFAULT '',
+    missing_crawls INTEGER          NOT NULL DEFAULT 0,
+    removed        TIMESTAMPTZ,
+    removal_reason TEXT             NOT NULL DEFAULT '',
+    canonical_id   BIGINT REFERENCES events (id)
+);
+
+CREATE UNIQUE INDEX events_uq_venue_title_date ON events (venue, title, date);
+CREATE UNIQUE INDEX events_uq_public_id ON events (public_id);
+
+CREATE TABLE updates
+(
+    id       BIGSERIAL PRIMARY KEY,
+    datetime TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    event_id BIGINT NOT NULL,
+    field    TEXT   NOT NULL,
+    old      TEXT   NOT NULL,
+    new      TEXT   NOT NULL
+);
+
+CREATE TABLE errors
+(
+    id       BIGSERIAL PRIMARY KEY,
+    datetime TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    crawler  TEXT NOT NULL,
+    msg      TEXT NOT NULL
+);
+
+CREATE TABLE keyvalue
+(
+    key   TEXT PRIMARY KEY,
+    value TEXT
+);
+
+CREATE TABLE event_details
+(
+    url           TEXT PRIMARY KEY,
+    details       TEXT        NOT NULL,
+    etag          TEXT        NOT NULL DEFAULT '',
+    last_modified TEXT        NOT NULL DEFAULT '',
+    fetched       TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO venues (id, url, name, shortname)
+VALUES (1, 'http://www.cafe-kairo.ch/kultur', 'Cafe Kairo', 'kairo'),
+       (2, 'http://www.dachstock.ch', 'Dachstock', 'dachstock'),
+       (3, 'http://www.turnhalle.ch', 'Turnhalle', 'turnhalle'),
+       (4, 'http://brasserie-lorraine.ch/?post_type=tribe_events', 'Brasserie Lorraine', 'brasserie-lorraine'),
+       (5, 'http://www.kofmehl.net', 'Kofmehl', 'kofmehl'),
+       (6, 'http://www.kiff.ch/de/home.html?view=list', 'Kiff', 'kiff'),
+       (7, 'http://www.coq-d-or.ch/', 'Coq d''Or', 'coq-d-or'),
+       (8, 'http://www.isc-club.ch/', 'ISC', 'isc'),
+       (9, 'https://www.mahogany.ch/konzerte', 'Mahogany Hall', 'mahogany-hall'),
+       (10, 'http://www.dieheiterefahne.ch/de/hauptnavigation/start/programm-31.html', 'Heitere Fahne', 'heitere-fahne'),
+       (11, 'http://www.onobern.ch/programm-bersicht', 'ONO Bern', 'ono'),
+       (12, 'http://www.cafemarta.ch/musik', 'Cafe Marta', 'marta'),
+       (13, 'http://www.bierhuebeli.ch/veranstaltungen/', 'Bierhübeli', 'bierhuebeli'),
+       (14, 'http://dampfzentrale.ch/programm/', 'Dampfzentrale', 'dampfzentrale'),
+       (15, 'https://www.souslepont-roessli.ch', 'Rössli', 'roessli'),
+       (16, 'https://www.souslepont-roessli.ch', 'Sous le Pont', 'sous-le-pont'),
+       (17, 'https://www.lesamis.ch/events2/', 'Les Amis', 'les-amis'),
+       (18, 'http://mokka.ch/programm/', 'Mokka', 'mokka'),
+       (19, 'http://www.muehlehunziken.ch', 'Mühle Hunziken', 'muehle-hunziken'),
+       (20, 'https://gaskessel.ch', 'Gaskessel', 'gaskessel');
+
+UPDATE venues
+SET building = 'souslepont-roessli'
+WHERE shortname IN ('roessli', 'sous-le-pont');
+
+SELECT setval('venues_id_seq', (SELECT MAX(id) FROM venues));
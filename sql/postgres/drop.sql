@@ -0,0 +1 @@
+DROP TABLE IF EXISTS events, opening_times, venues, updates, errors, keyvalue, event_details, schema_migrations CASCADE;
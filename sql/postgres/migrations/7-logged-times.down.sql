@@ -0,0 +1,7 @@
+-- the format of the database driver has no Z for UTC
+UPDATE updates
+SET old = substr(old, 1, 10) || ' ' || replace(substr(old, 12), 'Z', '+00:00')
+WHERE old LIKE '____-__-__T__:__:__%';
+UPDATE updates
+SET new = substr(new, 1, 10) || ' ' || replace(substr(new, 12), 'Z', '+00:00')
+WHERE new LIKE '____-__-__T__:__:__%';
@@ -0,0 +1,154 @@
+package wasgeit
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// statusPriority is the order in which statuses are detected, a cancelled show which was sold out is cancelled.
+var statusPriority = []EventStatus{StatusCancelled, StatusPostponed, StatusSoldOut}
+
+// DefaultStatusKeywords are the markers venues put into their listings, in German, French and English.
+var DefaultStatusKeywords = map[EventStatus][]string{
+	StatusCancelled: {"abgesagt", "annulliert", "fällt aus", "entfällt", "annulé", "annulée", "cancelled", "canceled"},
+	StatusPostponed: {"verschoben", "reporté", "reportée", "postponed"},
+	StatusSoldOut:   {"ausverkauft", "complet", "sold out", "soldout", "sold-out"},
+}
+
+// StatusConfig describes how the status of an event is read from the listing. Unless a marker selector matches, the
+// text of Selector and the title are searched for the keywords. A keyword found in the title is removed from it.
+type StatusConfig struct {
+	// Markers are selectors, relative to the event, of elements only present if the event has the given status
+	Markers map[EventStatus]string
+	// Selector is relative to the event and selects an element holding the status as text, e.g. a badge
+	Selector string
+	// matcher is nil if only the DefaultStatusKeywords are used
+	matcher *statusMatcher
+}
+
+var defaultStatusMatcher = newStatusMatcher(nil)
+
+// NewStatusConfig creates a StatusConfig looking for the given keywords in addition to DefaultStatusKeywords.
+func NewStatusConfig(keywords map[EventStatus][]string, markers map[EventStatus]string, selector string) StatusConfig {
+	config := StatusConfig{Markers: markers, Selector: selector}
+
+	if len(keywords) > 0 {
+		matcher := newStatusMatcher(keywords)
+		config.matcher = &matcher
+	}
+
+	return config
+}
+
+func (config StatusConfig) keywords() statusMatcher {
+	if config.matcher == nil {
+		return defaultStatusMatcher
+	}
+	return *config.matcher
+}
+
+// statusMatcher finds status keywords in texts.
+type statusMatcher struct {
+	patterns map[EventStatus]*regexp.Regexp
+}
+
+func newStatusMatcher(extraKeywords map[EventStatus][]string) statusMatcher {
+	matcher := statusMatcher{patterns: make(map[EventStatus]*regexp.Regexp)}
+
+	for _, status := range statusPriority {
+		var quoted []string
+		for _, keyword := range append(DefaultStatusKeywords[status], extraKeywords[status]...) {
+			// a blank in a keyword matches any whitespace, e.g. the non-breaking space of "sold out"
+			words := strings.Fields(keyword)
+			for i, word := range words {
+				words[i] = regexp.QuoteMeta(word)
+			}
+			quoted = append(quoted, strings.Join(words, `[\s\p{Zs}]+`))
+		}
+
+		// \b only knows ASCII, therefore word boundaries are spelled out to cope with keywords like "annulé"
+		matcher.patterns[status] = regexp.MustCompile(`(?i)(?:^|[^\pL\pN])(` + strings.Join(quoted, "|") + `)(?:[^\pL\pN]|$)`)
+	}
+
+	return matcher
+}
+
+func isDetectableStatus(status EventStatus) bool {
+	for _, s := range statusPriority {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the status found in s and the location of its keyword.
+func (matcher statusMatcher) find(s string) (EventStatus, []int) {
+	for _, status := range statusPriority {
+		if match := matcher.patterns[status].FindStringSubmatchIndex(s); match != nil {
+			return status, match[2:4]
+		}
+	}
+	return "", nil
+}
+
+const markerDelimiter = " \t-–—:|*!/,.()[]{}"
+
+// stripStatus removes the keyword found at the given location from the title, along with the punctuation that
+// separated it from the title, e.g. "ABGESAGT: Band" and "Band (sold out)" both become "Band".
+func stripStatus(title string, location []int) string {
+	before := strings.TrimRight(title[:location[0]], markerDelimiter)
+	after := strings.TrimLeft(title[location[1]:], markerDelimiter)
+
+	stripped := strings.TrimSpace(before + " " + after)
+
+	if stripped == "" {
+		return title
+	}
+
+	return strings.Join(strings.Fields(stripped), " ")
+}
+
+// status determines the status of an event and returns its title without the status marker.
+func (cr *HTMLCrawler) status(eventSelection *goquery.Selection, title string) (EventStatus, string) {
+	config := cr.config.Status
+	keywords := config.keywords()
+
+	for _, status := range statusPriority {
+		if marker, exists := config.Markers[status]; exists && eventSelection.Find(marker).Length() > 0 {
+			return status, stripAnyStatus(keywords, title)
+		}
+	}
+
+	if config.Selector != "" {
+		if status, _ := keywords.find(eventSelection.Find(config.Selector).Text()); status != "" {
+			return status, stripAnyStatus(keywords, title)
+		}
+	}
+
+	if status, _ := keywords.find(title); status != "" {
+		return status, stripAnyStatus(keywords, title)
+	}
+
+	return StatusScheduled, title
+}
+
+// stripAnyStatus removes all status markers from the title.
+func stripAnyStatus(keywords statusMatcher, title string) string {
+	for {
+		status, location := keywords.find(title)
+
+		if status == "" {
+			return title
+		}
+
+		stripped := stripStatus(title, location)
+
+		if stripped == title {
+			return title
+		}
+		title = stripped
+	}
+}
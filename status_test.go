@@ -0,0 +1,78 @@
+package wasgeit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestStatusFromTitle(t *testing.T) {
+	tests := []struct {
+		title  string
+		status EventStatus
+		clean  string
+	}{
+		{"Band", StatusScheduled, "Band"},
+		{"ABGESAGT: Band", StatusCancelled, "Band"},
+		{"Band (sold out)", StatusSoldOut, "Band"},
+		{"Band – sold out!", StatusSoldOut, "Band"},
+		{"*** VERSCHOBEN *** Band", StatusPostponed, "Band"},
+		{"Band – annulé", StatusCancelled, "Band"},
+		{"Band (abgesagt) mit Support", StatusCancelled, "Band mit Support"},
+		{"Ausverkauft - ABGESAGT: Band", StatusCancelled, "Band"},
+		{"Soldoutband", StatusScheduled, "Soldoutband"},
+		{"Abgesagt", StatusCancelled, "Abgesagt"},
+	}
+
+	cr := &HTMLCrawler{}
+
+	for _, test := range tests {
+		status, title := cr.status(&goquery.Selection{}, test.title)
+
+		if status != test.status || title != test.clean {
+			t.Errorf("expected %q to yield %q and %q, got %q and %q", test.title, test.status, test.clean, status, title)
+		}
+	}
+}
+
+func TestStatusFromMarkup(t *testing.T) {
+	def := StatusDefinition{
+		Keywords: map[EventStatus][]string{StatusSoldOut: {"keine tickets mehr"}},
+		Markers:  map[EventStatus]string{StatusCancelled: ".cancelled"},
+		Selector: ".badge",
+	}
+
+	config, err := def.compile()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr := &HTMLCrawler{config: HTMLConfig{Status: config}}
+
+	tests := []struct {
+		html   string
+		status EventStatus
+	}{
+		{`<div><span class="cancelled"></span></div>`, StatusCancelled},
+		{`<div><span class="badge">Keine Tickets mehr</span></div>`, StatusSoldOut},
+		{`<div><span class="badge">Heute</span></div>`, StatusScheduled},
+	}
+
+	for _, test := range tests {
+		dom, err := goquery.NewDocumentFromReader(strings.NewReader(test.html))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status, _ := cr.status(dom.Selection, "Band"); status != test.status {
+			t.Errorf("expected %s to yield %q, got %q", test.html, test.status, status)
+		}
+	}
+
+	if _, err := (StatusDefinition{Markers: map[EventStatus]string{"gone": ".gone"}}).compile(); err == nil {
+		t.Error("expected unknown status to be rejected")
+	}
+}
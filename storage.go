@@ -0,0 +1,64 @@
+package wasgeit
+
+import "time"
+
+// Storage persists the venues, events, updates, crawl errors, key-values and festivals. Store implements it on SQLite
+// and PostgreSQL, see Store.Connect.
+type Storage interface {
+	DetailCache
+
+	// Now is the time queries like GetEventsYetToHappen are relative to
+	Now() time.Time
+	Close() error
+
+	// schema
+	DropTables() error
+	CreateTables() error
+	Migrate() error
+	MigrateTo(target int) error
+	Migrations() ([]Migration, int, error)
+	SchemaVersion() (int, error)
+
+	// venues
+	FindVenue(shortName string) (Venue, error)
+
+	// events
+	FindEvents(crawlerName string) ([]Event, error)
+	SaveEvent(ev Event) error
+	UpdateEvent(id int64, fieldName string, value interface{}) error
+	SetMissingCrawls(id int64, missingCrawls int) error
+	MarkEventRemoved(ev Event) error
+	RestoreEvent(id int64) error
+	LinkDuplicates(clusters [][]Event) error
+	FindEvent(publicID string) (Event, error)
+	FindUpcomingEvents() ([]Event, error)
+	GetEventsYetToHappen() ([]Event, error)
+	GetEventsAddedDuringLastWeek() ([]Event, error)
+	FindAgenda(q AgendaQuery) (AgendaPage, error)
+	FindCalendarEvents(venue string) ([]Event, error)
+	SaveEventDetails(cached CachedDetails) error
+	// ApplyCrawl stores all the changes of a crawl at once
+	ApplyCrawl(cr Crawler, result CrawlResult) (CrawlSummary, error)
+
+	// search
+	HasSearchIndex() (bool, error)
+	RebuildSearchIndex() (int64, error)
+	Search(text string, limit int) ([]SearchResult, error)
+
+	// updates
+	LogUpdate(eventId int64, fieldName string, oldValue interface{}, newValue interface{}) error
+	FindEventUpdates(eventID int64) ([]EventUpdate, error)
+	FindRecentUpdates(filter UpdateFilter) ([]EventUpdate, error)
+	FindRevisions() (map[int64]Revision, error)
+
+	// errors
+	LogError(cr Crawler, errToLog error) error
+
+	// key-values
+	UpdateValue(key string, newValue string) error
+	ReadValue(key string) (string, error)
+	ReadCrawlTimes() (map[string]string, error)
+
+	// festivals
+	GetCurrentFestivals() ([]Festival, error)
+}
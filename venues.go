@@ -6,4 +6,14 @@ type Venue struct {
 	ShortName string
 	Name      string
 	URL       string
+	// Building is shared by venues located in the same building, e.g. roessli and sous-le-pont
+	Building string `json:"-"`
+}
+
+// LocationKey identifies the place a venue is located at.
+func (v Venue) LocationKey() string {
+	if v.Building != "" {
+		return v.Building
+	}
+	return v.ShortName
 }
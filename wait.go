@@ -0,0 +1,176 @@
+package wasgeit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWaitTimeout  = 10 * time.Second
+	defaultMaxLoadMore  = 10
+	networkIdleDuration = 500 * time.Millisecond
+	pollInterval        = 100 * time.Millisecond
+	maxScrolls          = 50
+)
+
+// WaitCondition describes when a page rendered by the browser is ready to be read. The steps are executed in the
+// order of the fields. Plain HTTP fetching ignores it.
+type WaitCondition struct {
+	// Visible is a CSS selector to wait for until it is visible
+	Visible string
+	// NetworkIdle waits until no resources were loaded for a short while
+	NetworkIdle bool
+	// ScrollToBottom scrolls down until the page stops growing, for lists loaded lazily while scrolling
+	ScrollToBottom bool
+	// LoadMore is a CSS selector of a "load more" button which is clicked until it disappears or MaxLoadMore is reached
+	LoadMore    string
+	MaxLoadMore int
+	// Timeout is the maximum time spent waiting, defaults to ten seconds
+	Timeout time.Duration
+}
+
+func (wait WaitCondition) timeout() time.Duration {
+	if wait.Timeout <= 0 {
+		return defaultWaitTimeout
+	}
+	return wait.Timeout
+}
+
+func (wait WaitCondition) actions() []chromedp.Action {
+	var actions []chromedp.Action
+
+	if wait.Visible != "" {
+		actions = append(actions, chromedp.WaitVisible(wait.Visible, chromedp.ByQuery))
+	}
+
+	if wait.NetworkIdle {
+		actions = append(actions, waitNetworkIdle())
+	}
+
+	if wait.ScrollToBottom {
+		actions = append(actions, scrollToBottom())
+	}
+
+	if wait.LoadMore != "" {
+		maxClicks := wait.MaxLoadMore
+		if maxClicks <= 0 {
+			maxClicks = defaultMaxLoadMore
+		}
+		actions = append(actions, clickLoadMore(wait.LoadMore, maxClicks))
+	}
+
+	return actions
+}
+
+// waitNetworkIdle polls the number of loaded resources until it did not change for networkIdleDuration.
+func waitNetworkIdle() chromedp.Action {
+	return chromedp.ActionFunc(func(ctxt context.Context) error {
+		var lastCount int
+		lastChange := time.Now()
+
+		for {
+			var state struct {
+				Ready     bool `json:"ready"`
+				Resources int  `json:"resources"`
+			}
+
+			err := chromedp.Evaluate(`({
+				ready: document.readyState === "complete",
+				resources: performance.getEntriesByType("resource").length
+			})`, &state).Do(ctxt)
+
+			if err != nil {
+				return err
+			}
+
+			if !state.Ready || state.Resources != lastCount {
+				lastCount = state.Resources
+				lastChange = time.Now()
+			} else if time.Since(lastChange) >= networkIdleDuration {
+				return nil
+			}
+
+			if err := sleep(ctxt, pollInterval); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func scrollToBottom() chromedp.Action {
+	return chromedp.ActionFunc(func(ctxt context.Context) error {
+		var lastHeight int
+
+		for i := 0; i < maxScrolls; i++ {
+			var height int
+
+			err := chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight); document.body.scrollHeight`,
+				&height).Do(ctxt)
+
+			if err != nil {
+				return err
+			}
+
+			if height == lastHeight {
+				return nil
+			}
+			lastHeight = height
+
+			if err := sleep(ctxt, networkIdleDuration); err != nil {
+				return err
+			}
+		}
+
+		log.Debugf("Page still growing after %d scrolls", maxScrolls)
+		return nil
+	})
+}
+
+func clickLoadMore(selector string, maxClicks int) chromedp.Action {
+	quotedSelector, _ := json.Marshal(selector)
+
+	// clicking via JavaScript as chromedp.Click would wait forever for a button which disappeared
+	script := fmt.Sprintf(`(function() {
+		var button = document.querySelector(%s);
+		if (button === null || button.offsetParent === null) {
+			return false;
+		}
+		button.click();
+		return true;
+	})()`, quotedSelector)
+
+	return chromedp.ActionFunc(func(ctxt context.Context) error {
+		for i := 0; i < maxClicks; i++ {
+			var clicked bool
+
+			if err := chromedp.Evaluate(script, &clicked).Do(ctxt); err != nil {
+				return err
+			}
+
+			if !clicked {
+				return nil
+			}
+
+			if err := waitNetworkIdle().Do(ctxt); err != nil {
+				return err
+			}
+		}
+
+		log.Debugf("Stopped clicking %q after %d clicks", selector, maxClicks)
+		return nil
+	})
+}
+
+func sleep(ctxt context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctxt.Done():
+		return ctxt.Err()
+	}
+}